@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cansyan/co/ui"
+)
+
+// command is something the user can do, called by its ID from key
+// bindings, the palette or the cheat sheet, and later menus or macros.
+type command struct {
+	ID       string      // e.g. "file.save", what keys are bound to
+	Category string      // e.g. "File", from the ID if empty
+	Title    string      // e.g. "Save", from the ID if empty
+	Key      string      // the default key, bound everywhere; more in defaultKeymap
+	Enabled  func() bool // whether it can run now, nil for always
+	Hidden   bool        // left out of the palette, e.g. moving the cursor
+	Run      func()
+}
+
+// Name returns the name listed in the palette and the cheat sheet.
+func (c *command) Name() string {
+	return c.Category + ": " + c.Title
+}
+
+func (c *command) enabled() bool {
+	return c.Enabled == nil || c.Enabled()
+}
+
+// commandRegistry holds the commands by ID, in the order they were registered.
+type commandRegistry struct {
+	byID  map[string]*command
+	order []*command
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{byID: make(map[string]*command)}
+}
+
+// register adds c. An ID used twice is a programming error.
+func (r *commandRegistry) register(c command) {
+	if _, ok := r.byID[c.ID]; ok {
+		panic(fmt.Sprintf("command %q registered twice", c.ID))
+	}
+	if c.Title == "" {
+		c.Category, c.Title, _ = strings.Cut(actionTitle(c.ID), ": ")
+	}
+	r.byID[c.ID] = &c
+	r.order = append(r.order, &c)
+}
+
+func (r *commandRegistry) lookup(id string) (*command, bool) {
+	c, ok := r.byID[id]
+	return c, ok
+}
+
+// run runs the command if it is enabled, reports whether it ran.
+func (r *commandRegistry) run(id string) bool {
+	c, ok := r.byID[id]
+	if !ok || !c.enabled() {
+		return false
+	}
+	c.Run()
+	return true
+}
+
+// list returns the commands in the order they were registered.
+func (r *commandRegistry) list() []*command {
+	return r.order
+}
+
+// defaultBindings returns the default keys of the commands.
+func (r *commandRegistry) defaultBindings() []keyBinding {
+	var bindings []keyBinding
+	for _, c := range r.order {
+		if c.Key != "" {
+			bindings = append(bindings, keyBinding{Key: c.Key, Command: c.ID})
+		}
+	}
+	return bindings
+}
+
+// fillCommandMode lists the commands that can run now, with their keys.
+func (a *App) fillCommandMode(p *Palette, query string) {
+	keys := a.boundKeys()
+	var commands []*command
+	for _, c := range a.commands.list() {
+		if !c.Hidden && c.enabled() {
+			commands = append(commands, c)
+		}
+	}
+	for _, r := range fuzzyFilter(query, commands, (*command).Name) {
+		p.list.Append(ui.ListItem{
+			Name:    r.text,
+			Detail:  strings.Join(keys[r.item.ID], ", "),
+			Value:   r.item.ID,
+			Matches: r.positions,
+		})
+	}
+
+	p.list.OnSelect = func(item ui.ListItem) {
+		// close the palette first, so the command runs where it was invoked
+		a.requestFocus()
+		a.commands.run(item.Value.(string))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	r := newCommandRegistry()
+	enabled, ran := false, 0
+	r.register(command{ID: "edit.selectWord", Run: func() { ran++ }})
+	r.register(command{ID: "file.save", Category: "File", Title: "Save All", Key: "ctrl+s",
+		Enabled: func() bool { return enabled }, Run: func() { ran++ }})
+
+	c, ok := r.lookup("edit.selectWord")
+	if !ok || c.Name() != "Edit: Select Word" {
+		t.Errorf("lookup(edit.selectWord) = %v, %v; want the name from the ID", c, ok)
+	}
+	if c, _ := r.lookup("file.save"); c.Name() != "File: Save All" {
+		t.Errorf("name = %q, want File: Save All", c.Name())
+	}
+
+	if r.run("file.save") || ran != 0 {
+		t.Error("a disabled command ran")
+	}
+	enabled = true
+	if !r.run("file.save") || ran != 1 {
+		t.Error("an enabled command did not run")
+	}
+	if r.run("nope") {
+		t.Error("an unknown command ran")
+	}
+
+	want := []keyBinding{{Key: "ctrl+s", Command: "file.save"}}
+	if got := r.defaultBindings(); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("defaultBindings() = %v, want %v", got, want)
+	}
+}
+
+func TestFillCommandMode(t *testing.T) {
+	app := newApp(ui.NewManager())
+	p := NewPalette(app)
+	app.fillCommandMode(p, "")
+
+	details := make(map[string]string)
+	for _, item := range p.list.Items {
+		details[item.Name] = item.Detail
+	}
+	// the shortcuts are shown, hidden and disabled commands left out
+	if d, ok := details["File: Save"]; ok {
+		t.Errorf("File: Save listed without a tab, %q", d)
+	}
+	if d := details["View: Toggle Explorer"]; d != "ctrl+k ctrl+b" {
+		t.Errorf("View: Toggle Explorer shows %q, want ctrl+k ctrl+b", d)
+	}
+	if _, ok := details["Cursor: Up"]; ok {
+		t.Error("hidden Cursor: Up listed")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/cansyan/co/ui"
+)
+
+// completion is a candidate offered by the completion popup.
+type completion struct {
+	Text    string
+	Kind    string   // shown next to the text, e.g. "func", "word"
+	snippet *snippet // inserted instead of Text, if set
+}
+
+// completer provides completion candidates for the word being typed.
+type completer interface {
+	Complete(prefix string) []completion
+}
+
+// completerFunc adapts a function to the completer interface.
+type completerFunc func(prefix string) []completion
+
+func (f completerFunc) Complete(prefix string) []completion { return f(prefix) }
+
+// maxCompletions limits how many candidates the popup keeps.
+const maxCompletions = 50
+
+// completeAll merges the candidates of several completers and ranks them:
+// case-sensitive prefix matches first, then by completer order,
+// then shorter text. Duplicates keep their best rank.
+func completeAll(completers []completer, prefix string) []completion {
+	type ranked struct {
+		completion
+		exact  bool
+		source int
+	}
+	var all []ranked
+	for i, c := range completers {
+		for _, item := range c.Complete(prefix) {
+			all = append(all, ranked{
+				completion: item,
+				exact:      strings.HasPrefix(item.Text, prefix),
+				source:     i,
+			})
+		}
+	}
+
+	slices.SortStableFunc(all, func(x, y ranked) int {
+		if x.exact != y.exact {
+			if x.exact {
+				return -1
+			}
+			return 1
+		}
+		if x.source != y.source {
+			return cmp.Compare(x.source, y.source)
+		}
+		if len(x.Text) != len(y.Text) {
+			return cmp.Compare(len(x.Text), len(y.Text))
+		}
+		return strings.Compare(x.Text, y.Text)
+	})
+
+	seen := make(map[string]bool)
+	var result []completion
+	for _, item := range all {
+		// a snippet doesn't hide the word it is named after
+		key := item.Text
+		if item.snippet != nil {
+			key += " snippet"
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, item.completion)
+		if len(result) == maxCompletions {
+			break
+		}
+	}
+	return result
+}
+
+// hasPrefixFold reports whether s starts with prefix ignoring case,
+// and is longer than it, so completing it adds something.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) > len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// symbolCompleter completes the symbols declared in the editor's file.
+func symbolCompleter(e *Editor) completer {
+	return completerFunc(func(prefix string) []completion {
+		var items []completion
+		for _, s := range e.symbols {
+			if hasPrefixFold(s.Name, prefix) {
+				items = append(items, completion{Text: s.Name, Kind: s.Kind})
+			}
+		}
+		return items
+	})
+}
+
+// wordCompleter completes words found in all open buffers.
+func wordCompleter(a *App) completer {
+	return completerFunc(func(prefix string) []completion {
+		var items []completion
+		seen := make(map[string]bool)
+		for _, t := range a.tabs {
+			for _, word := range t.editor.bufferWords() {
+				if seen[word] || !hasPrefixFold(word, prefix) {
+					continue
+				}
+				seen[word] = true
+				items = append(items, completion{Text: word, Kind: "word"})
+			}
+		}
+		return items
+	})
+}
+
+// bufferWords returns the distinct identifiers of the text. They are kept
+// until it changes, as every keystroke completes from all open buffers.
+func (e *Editor) bufferWords() []string {
+	if e.words != nil && e.wordsVersion == e.version {
+		return e.words
+	}
+	seen := make(map[string]bool)
+	e.words = e.words[:0]
+	for _, line := range e.buf {
+		for _, word := range lineWords(line) {
+			if !seen[word] {
+				seen[word] = true
+				e.words = append(e.words, word)
+			}
+		}
+	}
+	e.wordsVersion = e.version
+	return e.words
+}
+
+// lineWords returns the identifiers in a line.
+func lineWords(line []rune) []string {
+	var words []string
+	for i := 0; i < len(line); {
+		if !isAlphaNumeric(line[i]) {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(line) && isAlphaNumeric(line[j]) {
+			j++
+		}
+		if !unicode.IsDigit(line[i]) {
+			words = append(words, string(line[i:j]))
+		}
+		i = j
+	}
+	return words
+}
+
+var goKeywords = strings.Fields(`break case chan const continue default defer
+	else fallthrough for func go goto if import interface map package range
+	return select struct switch type var`)
+
+var goBuiltins = strings.Fields(`any append bool byte cap clear close comparable
+	complex complex64 complex128 copy delete error false float32 float64 imag
+	int int8 int16 int32 int64 iota len make max min new nil panic print println
+	real recover rune string true uint uint8 uint16 uint32 uint64 uintptr`)
+
+// keywordCompleter completes fixed words of a language.
+func keywordCompleter(kind string, words []string) completer {
+	return completerFunc(func(prefix string) []completion {
+		var items []completion
+		for _, w := range words {
+			if hasPrefixFold(w, prefix) {
+				items = append(items, completion{Text: w, Kind: kind})
+			}
+		}
+		return items
+	})
+}
+
+// updateCompletion refreshes the popup for the word before the cursor.
+// Unless explicit, it waits for two characters to avoid noise.
+func (e *Editor) updateCompletion(explicit bool) {
+	start, prefix, ok := e.PrefixAtCursor()
+	if !ok || (!explicit && len([]rune(prefix)) < 2) {
+		e.closeCompletion()
+		return
+	}
+	items := completeAll(e.completers, prefix)
+	if len(items) == 0 {
+		e.closeCompletion()
+		return
+	}
+
+	if e.completion == nil {
+		e.completion = new(ui.List)
+	}
+	e.completion.Clear()
+	for _, item := range items {
+		e.completion.Append(ui.ListItem{Name: item.Text, Detail: item.Kind, Value: item})
+	}
+	e.completion.Index = 0
+	e.completionStart = start
+	e.keepCompletion = true
+	// the popup takes over from the inline suggestion
+	e.clearSuggest()
+}
+
+func (e *Editor) completionOpen() bool {
+	return e.completion != nil && e.completion.Len() > 0
+}
+
+func (e *Editor) closeCompletion() {
+	e.completion = nil
+}
+
+// settleCompletion closes the popup unless the last key worked with it.
+func (e *Editor) settleCompletion() {
+	if !e.keepCompletion {
+		e.closeCompletion()
+	}
+	e.keepCompletion = false
+}
+
+// moveCompletion selects the next (dy > 0) or previous candidate.
+func (e *Editor) moveCompletion(dy int) {
+	if !e.completionOpen() {
+		return
+	}
+	if dy > 0 {
+		e.completion.Next()
+	} else {
+		e.completion.Prev()
+	}
+	e.keepCompletion = true
+}
+
+// acceptCompletion replaces the word before the cursor with the selected candidate.
+func (e *Editor) acceptCompletion() {
+	if !e.completionOpen() {
+		return
+	}
+	item := e.completion.Items[e.completion.Index].Value.(completion)
+	e.closeCompletion()
+	if item.snippet != nil {
+		e.insertSnippet(e.completionStart, *item.snippet)
+		return
+	}
+
+	e.SaveEdit()
+	e.MergeNext = false
+	e.ClearSelection()
+	e.DeleteRange(Pos{Row: e.Pos.Row, Col: e.completionStart}, e.Pos)
+	e.InsertText(item.Text)
+}
+
+// maxCompletionRows limits the height of the popup.
+const maxCompletionRows = 8
+
+// drawCompletion draws the popup below the word being completed,
+// or above it when there is no room below.
+func (e *Editor) drawCompletion(s ui.Screen, r ui.Rect) {
+	if !e.completionOpen() || !e.focused {
+		return
+	}
+	row := e.Pos.Row - e.offsetY
+	if row < 0 || row >= r.H {
+		return
+	}
+
+	lw, lh := e.completion.Size()
+	w := min(lw, 40) + 2 // +2 for the border
+	h := min(lh, maxCompletionRows) + 2
+	x := e.contentX + visualColFromLine(e.buf[e.Pos.Row], e.completionStart) - 2
+	x = max(r.X, min(x, r.X+r.W-w))
+	y := r.Y + row + 1
+	if y+h > r.Y+r.H {
+		y = r.Y + row - h
+	}
+	if y < r.Y {
+		return
+	}
+
+	ui.Border(e.completion).Layout(ui.Rect{X: x, Y: y, W: w, H: h}).Draw(s)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestCompleteAll(t *testing.T) {
+	symbols := completerFunc(func(string) []completion {
+		return []completion{{Text: "Println", Kind: "func"}, {Text: "printer", Kind: "type"}}
+	})
+	words := completerFunc(func(string) []completion {
+		return []completion{{Text: "print", Kind: "word"}, {Text: "printer", Kind: "word"}, {Text: "Print", Kind: "word"}}
+	})
+
+	got := completeAll([]completer{symbols, words}, "pr")
+	want := []completion{
+		{Text: "printer", Kind: "type"},
+		{Text: "print", Kind: "word"},
+		{Text: "Println", Kind: "func"},
+		{Text: "Print", Kind: "word"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("completeAll() = %v, want %v", got, want)
+	}
+}
+
+func TestLineWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"fmt.Println(x, 42)", []string{"fmt", "Println", "x"}},
+		{"  _tmp := a1b2 // 中文", []string{"_tmp", "a1b2", "中文"}},
+	}
+	for _, tt := range tests {
+		if got := lineWords([]rune(tt.line)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lineWords(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestBufferWords(t *testing.T) {
+	a := newApp(ui.NewManager())
+	e := a.newTab("untitled")
+	e.SetText("foo bar foo")
+	if got, want := e.bufferWords(), []string{"foo", "bar"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bufferWords() = %q, want %q", got, want)
+	}
+
+	// the words are read again once the text changes
+	e.SetCursor(0, 11)
+	e.InsertText(" baz")
+	if got, want := e.bufferWords(), []string{"foo", "bar", "baz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after edit, bufferWords() = %q, want %q", got, want)
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	app := newApp(ui.NewManager())
+	e := app.newTab("test.go")
+	e.SetText("func handleRequest() {}\nfunc handleResponse() {}\n\nha")
+	e.updateSymbols()
+	e.SetCursor(3, 2)
+
+	e.updateCompletion(false)
+	if !e.completionOpen() {
+		t.Fatal("completion popup not open")
+	}
+	// the two functions, then the "handler" snippet
+	if n := e.completion.Len(); n != 3 {
+		t.Fatalf("completion items = %d, want 3", n)
+	}
+
+	e.moveCompletion(1)
+	e.acceptCompletion()
+	if got := string(e.Line(3)); got != "handleResponse" {
+		t.Errorf("after accept line = %q, want %q", got, "handleResponse")
+	}
+	if e.completionOpen() {
+		t.Error("completion popup still open after accept")
+	}
+
+	e.Undo()
+	if got := string(e.Line(3)); got != "ha" {
+		t.Errorf("after undo line = %q, want %q", got, "ha")
+	}
+}
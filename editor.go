@@ -1,8 +1,10 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"maps"
 	"slices"
 	"strconv"
 	"strings"
@@ -24,9 +26,10 @@ type editRecord struct {
 
 // editor is a multi-line editable text area, and implements the ui.Element interface.
 type editor struct {
-	buf     [][]rune // row-major text buffer
-	Pos     Pos      // cursor position; also selection end
-	goalCol int      // desired visual column when moving vertically
+	buf         [][]rune // row-major text buffer
+	Pos         Pos      // cursor position; also selection end
+	goalCol     int      // desired visual column when moving vertically
+	keepGoalCol bool     // whether the last key moved vertically
 
 	anchor    Pos // selection anchor (fixed head)
 	selecting bool
@@ -42,7 +45,9 @@ type editor struct {
 	Highlighter func(line []rune) []StyleSpan // function to get syntax highlighting spans
 
 	onChange func()
+	version  int // counts the changes of the text, for what is derived from it
 	Dirty    bool
+	ReadOnly bool // ignores typing, the app also skips its edit actions
 
 	// Undo/redo history
 	undoStack []editRecord
@@ -51,19 +56,29 @@ type editor struct {
 
 	// Inline suggestion
 	InlineSuggest bool
-	// function to get suggestion based on current prefix
+	// function to get suggestion based on current prefix,
+	// called on its own goroutine
 	Suggester func(ctx context.Context, prefix string) string
-	// timeout for suggester calls (default 100ms)
+	// timeout for suggester calls, none by default: a slow suggester can
+	// take its time, its call is cancelled once the prefix or the cursor
+	// changes anyway
 	SuggesterTimeout time.Duration
-	currentSuggest   string
+	// Post runs a function on the UI goroutine, suggestions are applied through it
+	Post           func(func())
+	currentSuggest string
+	cancelSuggest  context.CancelFunc // cancels the pending suggester call
+	suggestGen     int                // identifies the latest suggester call
 
 	IndentGuide bool // whether to show indentation guides
+
+	snippet *snippetSession // the snippet being filled in, nil if none
+
+	decorations map[string][]Decoration // named layers, see SetDecorations
 }
 
 func newEditor() *editor {
 	e := &editor{
-		buf:              [][]rune{{}}, // Start with one empty line of runes
-		SuggesterTimeout: 100 * time.Millisecond,
+		buf: [][]rune{{}}, // Start with one empty line of runes
 	}
 	return e
 }
@@ -86,11 +101,13 @@ func (e *editor) String() string {
 }
 
 func (e *editor) SetText(s string) {
+	e.clearSuggest()
 	lines := strings.Split(s, "\n")
 	e.buf = make([][]rune, len(lines))
 	for i, line := range lines {
 		e.buf[i] = []rune(line)
 	}
+	e.version++
 	e.Pos = Pos{Row: 0, Col: 0}
 	e.adjustCol()
 }
@@ -100,6 +117,7 @@ func (e *editor) SetCursor(row, col int) {
 	if row < 0 || row >= len(e.buf) || col < 0 {
 		return
 	}
+	e.clearSuggest()
 	e.ClearSelection()
 	e.Pos = Pos{Row: row, Col: col}
 	e.adjustCol()
@@ -317,6 +335,8 @@ func (e *editor) drawLine(s ui.Screen, x, y, maxWidth, row int, line []rune) {
 		styles = expandStyles(spans, e.Style, len(line))
 	}
 
+	decor := e.decorationStyles(row, len(line))
+
 	visualCol := 0
 	for col, r := range line {
 		// Draw inline suggestion at cursor position (before cursor character)
@@ -329,6 +349,9 @@ func (e *editor) drawLine(s ui.Screen, x, y, maxWidth, row int, line []rune) {
 		if styles != nil {
 			style = styles[col]
 		}
+		if decor != nil {
+			style = decor[col].Merge(style)
+		}
 		if e.isSelected(Pos{Row: row, Col: col}) {
 			style.BG = ui.Theme.Selection
 		}
@@ -344,7 +367,61 @@ func (e *editor) drawLine(s ui.Screen, x, y, maxWidth, row int, line []rune) {
 	if e.isSelected(Pos{Row: row, Col: len(line)}) {
 		style := e.Style.Merge(ui.Style{BG: ui.Theme.Selection})
 		e.drawRune(s, x+visualCol, y, maxWidth-visualCol, ' ', visualCol, style)
+	} else if decor != nil && decor[len(line)] != (ui.Style{}) {
+		style := decor[len(line)].Merge(e.Style)
+		e.drawRune(s, x+visualCol, y, maxWidth-visualCol, ' ', visualCol, style)
+	}
+}
+
+// Decoration styles a range of text over the syntax highlighting,
+// such as a search match. The selection is still drawn on top.
+type Decoration struct {
+	Start, End Pos
+	Style      ui.Style
+}
+
+// SetDecorations replaces a named layer of decorations, so features can
+// manage theirs independently. Within a layer, decorations must be sorted
+// and must not overlap.
+func (e *editor) SetDecorations(layer string, ds []Decoration) {
+	if len(ds) == 0 {
+		delete(e.decorations, layer)
+		return
+	}
+	if e.decorations == nil {
+		e.decorations = make(map[string][]Decoration)
+	}
+	e.decorations[layer] = ds
+}
+
+// decorationStyles returns the decoration style of each column of a row,
+// followed by that of its line end, or nil if nothing decorates the row.
+func (e *editor) decorationStyles(row, n int) []ui.Style {
+	var styles []ui.Style
+	for _, layer := range slices.Sorted(maps.Keys(e.decorations)) {
+		ds := e.decorations[layer]
+		// skip the decorations that end before the row
+		i, _ := slices.BinarySearchFunc(ds, row, func(d Decoration, row int) int {
+			return cmp.Compare(d.End.Row, row)
+		})
+		for ; i < len(ds) && ds[i].Start.Row <= row; i++ {
+			d := ds[i]
+			from, to := 0, n+1
+			if d.Start.Row == row {
+				from = d.Start.Col
+			}
+			if d.End.Row == row {
+				to = d.End.Col
+			}
+			if styles == nil {
+				styles = make([]ui.Style, n+1)
+			}
+			for col := from; col < min(to, n+1); col++ {
+				styles[col] = d.Style.Merge(styles[col])
+			}
+		}
 	}
+	return styles
 }
 
 func (e *editor) drawSuggestion(s ui.Screen, x, y, maxWidth, visualCol int) int {
@@ -357,7 +434,11 @@ func (e *editor) drawSuggestion(s ui.Screen, x, y, maxWidth, visualCol int) int
 		return visualCol
 	}
 
-	for _, r := range e.currentSuggest[end-start:] {
+	rs := []rune(e.currentSuggest)
+	if end-start > len(rs) {
+		return visualCol
+	}
+	for _, r := range rs[end-start:] {
 		if visualCol >= maxWidth {
 			break
 		}
@@ -369,228 +450,232 @@ func (e *editor) drawSuggestion(s ui.Screen, x, y, maxWidth, visualCol int) int
 func (e *editor) OnFocus() { e.focused = true }
 func (e *editor) OnBlur()  { e.focused = false }
 
-func (e *editor) HandleKey(ev *tcell.EventKey) (consumed bool) {
-	keepVisualCol := false
-	defer func() {
-		if !keepVisualCol {
-			e.goalCol = 0
-		}
-	}()
+// HandleKey inserts typed characters. Every other key is an action bound
+// in the keymap, see the cursor and edit methods below.
+func (e *editor) HandleKey(ev *tcell.EventKey) bool {
+	defer e.settleGoalCol()
+	if ev.Key() != tcell.KeyRune || e.ReadOnly {
+		return false
+	}
+	e.InsertRune(ev.Rune())
+	return true
+}
 
-	onChange := func() {
-		if e.onChange != nil {
-			e.onChange()
-		}
+// settleGoalCol forgets the goal column unless the last key moved the
+// cursor vertically, so a run of up/down keys keeps its visual column.
+func (e *editor) settleGoalCol() {
+	if !e.keepGoalCol {
+		e.goalCol = 0
 	}
+	e.keepGoalCol = false
+}
 
-	consumed = true
-	switch ev.Key() {
-	case tcell.KeyESC:
-		if !e.selecting && e.currentSuggest == "" {
-			// nothing to do, bubble event to parent
-			return false
-		}
+func (e *editor) changed() {
+	e.version++
+	if e.onChange != nil {
+		e.onChange()
+	}
+}
+
+// Cancel clears the selection and the inline suggestion,
+// reports whether there was anything to clear.
+func (e *editor) Cancel() bool {
+	if !e.selecting && e.currentSuggest == "" {
+		return false
+	}
+	e.ClearSelection()
+	e.clearSuggest()
+	return true
+}
+
+func (e *editor) MoveUp() {
+	e.moveVertical(-1)
+}
+
+func (e *editor) MoveDown() {
+	e.moveVertical(1)
+}
+
+func (e *editor) moveVertical(dy int) {
+	e.ClearSelection()
+	e.clearSuggest()
+	e.keepGoalCol = true
+	if e.goalCol == 0 {
+		e.goalCol = visualColFromLine(e.buf[e.Pos.Row], e.Pos.Col)
+	}
+	row := e.Pos.Row + dy
+	if row < 0 || row >= len(e.buf) {
+		return
+	}
+	e.Pos.Row = row
+	e.Pos.Col = visualColToLine(e.buf[e.Pos.Row], e.goalCol)
+	e.adjustCol()
+	e.EnsureVisible(e.Pos.Row)
+}
+
+func (e *editor) MoveLeft() {
+	e.clearSuggest()
+	if start, _, ok := e.Selection(); ok {
+		e.Pos = start
 		e.ClearSelection()
-		e.currentSuggest = ""
-	case tcell.KeyUp:
+		return
+	}
+	e.ClearSelection()
+
+	if e.Pos.Col > 0 {
+		e.Pos.Col--
+	} else if e.Pos.Row > 0 {
+		e.Pos.Row--
+		e.Pos.Col = len(e.buf[e.Pos.Row]) // End of previous line
+		e.EnsureVisible(e.Pos.Row)
+	}
+}
+
+func (e *editor) MoveRight() {
+	e.clearSuggest()
+	if _, end, ok := e.Selection(); ok {
+		e.Pos = end
 		e.ClearSelection()
-		e.currentSuggest = ""
-		if ev.Modifiers()&tcell.ModMeta != 0 {
-			e.Pos.Row, e.Pos.Col = 0, 0
-			e.EnsureVisible(e.Pos.Row)
-			return
-		}
+		return
+	}
+	e.ClearSelection()
 
-		keepVisualCol = true
-		if e.goalCol == 0 {
-			e.goalCol = visualColFromLine(e.buf[e.Pos.Row], e.Pos.Col)
-		}
-		if e.Pos.Row > 0 {
-			e.Pos.Row--
-			e.Pos.Col = visualColToLine(e.buf[e.Pos.Row], e.goalCol)
-			e.adjustCol()
-			e.EnsureVisible(e.Pos.Row)
+	if e.Pos.Col < len(e.buf[e.Pos.Row]) {
+		e.Pos.Col++
+	} else if e.Pos.Row < len(e.buf)-1 {
+		e.Pos.Row++
+		e.Pos.Col = 0 // Start of next line
+		e.EnsureVisible(e.Pos.Row)
+	}
+}
+
+// MoveLineStart moves the cursor to the first non-space character of the line.
+func (e *editor) MoveLineStart() {
+	e.ClearSelection()
+	e.clearSuggest()
+	for i, char := range e.buf[e.Pos.Row] {
+		if !unicode.IsSpace(char) {
+			e.Pos.Col = i
+			break
 		}
-	case tcell.KeyDown:
+	}
+}
+
+func (e *editor) MoveLineEnd() {
+	e.ClearSelection()
+	e.clearSuggest()
+	e.Pos.Col = len(e.buf[e.Pos.Row])
+}
+
+// InsertNewline breaks the line at the cursor, keeping its indentation.
+func (e *editor) InsertNewline() {
+	e.clearSuggest()
+	e.SaveEdit()
+	e.MergeNext = false
+	defer e.changed()
+	e.Dirty = true
+	if start, end, ok := e.Selection(); ok {
+		e.DeleteRange(start, end)
 		e.ClearSelection()
-		e.currentSuggest = ""
-		if ev.Modifiers()&tcell.ModMeta != 0 {
-			e.Pos.Row, e.Pos.Col = len(e.buf)-1, 0
-			e.EnsureVisible(e.Pos.Row)
-			return
-		}
+	}
+	head := e.buf[e.Pos.Row][:e.Pos.Col]
+	tail := e.buf[e.Pos.Row][e.Pos.Col:]
 
-		keepVisualCol = true
-		if e.goalCol == 0 {
-			e.goalCol = visualColFromLine(e.buf[e.Pos.Row], e.Pos.Col)
-		}
-		if e.Pos.Row < len(e.buf)-1 {
-			e.Pos.Row++
-			e.Pos.Col = visualColToLine(e.buf[e.Pos.Row], e.goalCol)
-			e.adjustCol()
-			e.EnsureVisible(e.Pos.Row)
-		}
-	case tcell.KeyLeft:
-		e.currentSuggest = ""
-		if ev.Modifiers()&tcell.ModMeta != 0 {
-			e.ClearSelection()
-			firstNonSpace := 0
-			for i, ch := range e.buf[e.Pos.Row] {
-				if !unicode.IsSpace(ch) {
-					firstNonSpace = i
-					break
-				}
-			}
-			e.Pos.Col = firstNonSpace
-			return
-		}
-		if start, _, ok := e.Selection(); ok {
-			e.Pos = start
-			e.ClearSelection()
-			return
+	// keep indentation
+	lead := 0
+	for _, r := range head {
+		if unicode.IsSpace(r) {
+			lead++
+		} else {
+			break
 		}
+	}
+	newLine := make([]rune, lead+len(tail))
+	copy(newLine, head[:lead])
+	copy(newLine[lead:], tail)
 
-		if e.Pos.Col > 0 {
-			e.Pos.Col--
-		} else if e.Pos.Row > 0 {
-			e.Pos.Row--
-			e.Pos.Col = len(e.buf[e.Pos.Row]) // End of previous line
-			e.EnsureVisible(e.Pos.Row)
-		}
-	case tcell.KeyRight:
-		e.currentSuggest = ""
-		if ev.Modifiers()&tcell.ModMeta != 0 {
-			e.ClearSelection()
-			e.Pos.Col = len(e.buf[e.Pos.Row])
-			return
-		}
-		if _, end, ok := e.Selection(); ok {
-			e.Pos = end
-			e.ClearSelection()
-			return
-		}
-		if e.Pos.Col < len(e.buf[e.Pos.Row]) {
-			e.Pos.Col++
-		} else if e.Pos.Row < len(e.buf)-1 {
-			e.Pos.Row++
-			e.Pos.Col = 0 // Start of next line
-			e.EnsureVisible(e.Pos.Row)
-		}
-	case tcell.KeyEnter:
-		e.currentSuggest = ""
-		e.SaveEdit()
-		e.MergeNext = false
-		defer onChange()
-		e.Dirty = true
-		if start, end, ok := e.Selection(); ok {
-			e.DeleteRange(start, end)
-			e.ClearSelection()
-		}
-		head := e.buf[e.Pos.Row][:e.Pos.Col]
-		tail := e.buf[e.Pos.Row][e.Pos.Col:]
-
-		// keep indentation
-		lead := 0
-		for _, r := range head {
-			if unicode.IsSpace(r) {
-				lead++
-			} else {
-				break
-			}
-		}
-		newLine := make([]rune, lead+len(tail))
-		copy(newLine, head[:lead])
-		copy(newLine[lead:], tail)
+	e.buf[e.Pos.Row] = head
+	e.buf = slices.Insert(e.buf, e.Pos.Row+1, newLine)
 
-		e.buf[e.Pos.Row] = head
-		e.buf = slices.Insert(e.buf, e.Pos.Row+1, newLine)
+	e.Pos.Row++
+	e.Pos.Col = lead
+	e.EnsureVisible(e.Pos.Row)
+}
 
-		e.Pos.Row++
-		e.Pos.Col = lead
-		e.EnsureVisible(e.Pos.Row)
-	case tcell.KeyBackspace, tcell.KeyBackspace2:
-		if !e.MergeNext {
-			e.SaveEdit()
-		}
-		e.MergeNext = true
-		defer onChange()
-		e.Dirty = true
-		if start, end, ok := e.Selection(); ok {
-			e.DeleteRange(start, end)
-			e.ClearSelection()
-			e.updateInlineSuggest()
-			return
-		}
-		if e.Pos.Col > 0 {
-			e.buf[e.Pos.Row] = slices.Delete(e.buf[e.Pos.Row], e.Pos.Col-1, e.Pos.Col)
-			e.Pos.Col--
-			e.updateInlineSuggest()
-		} else if e.Pos.Row > 0 {
-			prevLine := e.buf[e.Pos.Row-1]
-			e.Pos.Col = len(prevLine)
-			e.buf[e.Pos.Row-1] = append(prevLine, e.buf[e.Pos.Row]...)
-
-			e.buf = slices.Delete(e.buf, e.Pos.Row, e.Pos.Row+1)
-			e.Pos.Row--
-			e.EnsureVisible(e.Pos.Row)
-			e.currentSuggest = ""
-		}
-	case tcell.KeyRune:
-		if !e.MergeNext {
-			e.SaveEdit()
-		}
-		e.MergeNext = true
-		defer onChange()
-		e.Dirty = true
-		// 如果有選取，先刪除選取範圍，再插入字元
-		if start, end, ok := e.Selection(); ok {
-			e.DeleteRange(start, end)
-			e.ClearSelection()
-		}
-		r := ev.Rune()
-		e.buf[e.Pos.Row] = slices.Insert(e.buf[e.Pos.Row], e.Pos.Col, r)
-		e.Pos.Col++
+// DeleteBackward deletes the selection, or the character before the cursor.
+func (e *editor) DeleteBackward() {
+	if !e.MergeNext {
+		e.SaveEdit()
+	}
+	e.MergeNext = true
+	defer e.changed()
+	e.Dirty = true
+	if start, end, ok := e.Selection(); ok {
+		e.DeleteRange(start, end)
+		e.ClearSelection()
 		e.updateInlineSuggest()
-	case tcell.KeyTAB:
-		// Try to accept inline suggestion first
-		if e.InlineSuggest && e.currentSuggest != "" {
-			e.SaveEdit()
-			e.MergeNext = false
-			defer onChange()
-			e.Dirty = true
-			start, _, ok := e.WordRangeAtCursor()
-			if ok {
-				e.DeleteRange(Pos{Row: e.Pos.Row, Col: start}, e.Pos)
-			}
-			e.InsertText(e.currentSuggest)
-			e.currentSuggest = ""
-			return true
-		}
+		return
+	}
+	if e.Pos.Col > 0 {
+		e.buf[e.Pos.Row] = slices.Delete(e.buf[e.Pos.Row], e.Pos.Col-1, e.Pos.Col)
+		e.Pos.Col--
+		e.updateInlineSuggest()
+	} else if e.Pos.Row > 0 {
+		prevLine := e.buf[e.Pos.Row-1]
+		e.Pos.Col = len(prevLine)
+		e.buf[e.Pos.Row-1] = append(prevLine, e.buf[e.Pos.Row]...)
+
+		e.buf = slices.Delete(e.buf, e.Pos.Row, e.Pos.Row+1)
+		e.Pos.Row--
+		e.EnsureVisible(e.Pos.Row)
+		e.clearSuggest()
+	}
+}
 
+// InsertRune replaces the selection, if any, with r.
+func (e *editor) InsertRune(r rune) {
+	if !e.MergeNext {
+		e.SaveEdit()
+	}
+	e.MergeNext = true
+	defer e.changed()
+	e.Dirty = true
+	if start, end, ok := e.Selection(); ok {
+		e.DeleteRange(start, end)
+		e.ClearSelection()
+	}
+	e.buf[e.Pos.Row] = slices.Insert(e.buf[e.Pos.Row], e.Pos.Col, r)
+	e.Pos.Col++
+	e.updateInlineSuggest()
+}
+
+// InsertTab accepts the inline suggestion if there is one,
+// otherwise inserts a tab character.
+func (e *editor) InsertTab() {
+	if e.InlineSuggest && e.currentSuggest != "" {
 		e.SaveEdit()
 		e.MergeNext = false
-		defer onChange()
+		defer e.changed()
 		e.Dirty = true
-		if start, end, ok := e.Selection(); ok {
-			e.DeleteRange(start, end)
-			e.ClearSelection()
-		}
-		e.buf[e.Pos.Row] = slices.Insert(e.buf[e.Pos.Row], e.Pos.Col, '\t')
-		e.Pos.Col++
-	case tcell.KeyHome:
-		// goto the first non-space character
-		for i, char := range e.buf[e.Pos.Row] {
-			if !unicode.IsSpace(char) {
-				e.Pos.Col = i
-				break
-			}
+		start, _, ok := e.WordRangeAtCursor()
+		if ok {
+			e.DeleteRange(Pos{Row: e.Pos.Row, Col: start}, e.Pos)
 		}
-	case tcell.KeyEnd:
-		e.Pos.Col = len(e.buf[e.Pos.Row])
-	default:
-		consumed = false
+		e.InsertText(e.currentSuggest)
+		e.clearSuggest()
+		return
 	}
-	return consumed
+
+	e.SaveEdit()
+	e.MergeNext = false
+	defer e.changed()
+	e.Dirty = true
+	if start, end, ok := e.Selection(); ok {
+		e.DeleteRange(start, end)
+		e.ClearSelection()
+	}
+	e.buf[e.Pos.Row] = slices.Insert(e.buf[e.Pos.Row], e.Pos.Col, '\t')
+	e.Pos.Col++
 }
 
 func (e *editor) OnMouseUp(x, y int) {
@@ -601,7 +686,8 @@ func (e *editor) OnMouseUp(x, y int) {
 }
 
 func (e *editor) OnMouseDown(x, y int) {
-	e.currentSuggest = ""
+	e.clearSuggest()
+	e.snippet = nil
 	// Calculate the target row (relative to content)
 	targetRow := y + e.offsetY
 
@@ -657,6 +743,7 @@ func (e *editor) SetSelection(start, end Pos) {
 	if start.Row < 0 || start.Row > length-1 || end.Row < 0 || end.Row > length-1 {
 		return
 	}
+	e.clearSuggest()
 	e.anchor = start
 	e.Pos = end
 	e.selecting = true
@@ -857,66 +944,65 @@ func (e *editor) findClosingBracket(openRow, openCol int, openCh rune) (closeRow
 	return -1, -1
 }
 
-// FindNext 尋找下一個匹配項並更新選區
+// FindNext selects the next exact occurrence of query after the cursor.
 func (e *editor) FindNext(query string) {
+	e.FindNextWith(query, findOptions{caseSensitive: true})
+}
+
+// FindNextWith selects the next match of query after the cursor,
+// wrapping around at the end of the buffer.
+func (e *editor) FindNextWith(query string, opts findOptions) {
 	if query == "" {
 		return
 	}
-	qRunes := []rune(query)
-	qLen := len(qRunes)
-	lineCount := len(e.buf)
-
-	// 從當前位置之後開始搜尋
-	startRow := e.Pos.Row
-	startCol := e.Pos.Col
-
-	for i := range lineCount {
-		// 使用取模實現 Wrap Around (循環搜尋)
-		currentRow := (startRow + i) % lineCount
-		line := e.buf[currentRow]
-
-		// 如果是起始行，從當前列開始找；否則從行首開始找
-		searchFromCol := 0
-		if i == 0 {
-			searchFromCol = startCol
-		}
+	m, err := opts.compile(query)
+	if err != nil {
+		return
+	}
+	// the search goes from the line of the cursor, where ^ and \b still
+	// see what is before, and the whole text is only looked at to wrap
+	from := Pos{Row: e.Pos.Row}
+	text := e.textFrom(e.Pos.Row)
+	loc := m.first(text, len(string(e.buf[e.Pos.Row][:e.Pos.Col])))
+	if loc == nil {
+		from = Pos{}
+		text = e.String()
+		loc = m.first(text, 0)
+	}
+	if loc == nil {
+		return
+	}
+	start := advancePos(from, text[:loc[0]])
+	end := advancePos(start, text[loc[0]:loc[1]])
+	e.SetSelection(start, end)
+	e.CenterRow(start.Row)
+}
 
-		if searchFromCol >= len(line) && i == 0 {
+// textFrom returns the text from the start of row to the end, as String
+// does for the whole.
+func (e *editor) textFrom(row int) string {
+	var sb strings.Builder
+	for i, line := range e.buf[row:] {
+		sb.WriteString(string(line))
+		if row+i == len(e.buf)-1 && len(line) == 0 {
 			continue
 		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
 
-		// 在當前行中尋找匹配
-		foundIdx := -1
-		remaining := line[searchFromCol:]
-		for j := 0; j <= len(remaining)-qLen; j++ {
-			match := true
-			for k := range qLen {
-				if remaining[j+k] != qRunes[k] {
-					match = false
-					break
-				}
-			}
-			if match {
-				foundIdx = j
-				break
-			}
-		}
-
-		if foundIdx != -1 {
-			// 找到匹配項後的座標計算
-			actualCol := searchFromCol + foundIdx
-
-			// 1. 更新選區：從匹配項開始到結束
-			e.anchor = Pos{Row: currentRow, Col: actualCol}
-			e.Pos.Row = currentRow
-			e.Pos.Col = actualCol + qLen
-			e.selecting = true
-
-			// 3. 確保視覺調整
-			e.CenterRow(currentRow)
-			return
+// advancePos returns the position after s, read from p.
+func advancePos(p Pos, s string) Pos {
+	for _, r := range s {
+		if r == '\n' {
+			p.Row++
+			p.Col = 0
+		} else {
+			p.Col++
 		}
 	}
+	return p
 }
 
 // SelectedText 回傳當前選區的字串內容
@@ -925,7 +1011,20 @@ func (e *editor) SelectedText() string {
 	if !ok {
 		return ""
 	}
+	return e.textRange(start, end)
+}
 
+// byteOffset returns the offset of p in bytes in the text of String.
+func (e *editor) byteOffset(p Pos) int {
+	off := 0
+	for _, line := range e.buf[:p.Row] {
+		off += len(string(line)) + 1
+	}
+	return off + len(string(e.buf[p.Row][:p.Col]))
+}
+
+// textRange returns the text from start up to end.
+func (e *editor) textRange(start, end Pos) string {
 	if start.Row == end.Row {
 		return string(e.buf[start.Row][start.Col:end.Col])
 	}
@@ -968,6 +1067,11 @@ type Pos struct {
 	Col int
 }
 
+// Before reports whether p comes before q in the text.
+func (p Pos) Before(q Pos) bool {
+	return p.Row < q.Row || (p.Row == q.Row && p.Col < q.Col)
+}
+
 func (p Pos) Advance(rs []rune) Pos {
 	for _, r := range rs {
 		if r == '\n' {
@@ -1012,6 +1116,7 @@ func (e *editor) InsertText(s string) {
 	if s == "" {
 		return
 	}
+	e.clearSuggest()
 
 	// selection
 	if start, end, ok := e.Selection(); ok {
@@ -1029,9 +1134,37 @@ func (e *editor) InsertText(s string) {
 	// UI side effects
 	e.EnsureVisible(e.Pos.Row)
 	e.Dirty = true
-	if e.onChange != nil {
-		e.onChange()
+	e.changed()
+}
+
+// ReplaceText replaces the whole text, as returned by String, with s as a
+// single undo step, keeping the cursor where it was as far as possible.
+func (e *editor) ReplaceText(s string) {
+	// String ends a non-empty last line with a newline,
+	// which SetText would turn into an extra line.
+	if len(e.buf[len(e.buf)-1]) > 0 {
+		s = strings.TrimSuffix(s, "\n")
 	}
+
+	pos := e.Pos
+	e.SaveEdit()
+	e.MergeNext = false
+	e.SetText(s)
+	e.SetCursor(min(pos.Row, e.Len()-1), pos.Col)
+	e.EnsureVisible(e.Pos.Row)
+	e.Dirty = true
+	e.changed()
+}
+
+// Append adds text at the end, leaving the cursor, the selection and the
+// view where they are, for output that streams in.
+func (e *editor) Append(s string) {
+	if s == "" {
+		return
+	}
+	last := len(e.buf) - 1
+	e.insertRunes(Pos{Row: last, Col: len(e.buf[last])}, []rune(s))
+	e.changed()
 }
 
 func splitRunesByNewline(rs []rune) [][]rune {
@@ -1117,9 +1250,7 @@ func (e *editor) DeleteRange(start, end Pos) {
 
 	e.EnsureVisible(e.Pos.Row)
 	e.Dirty = true
-	if e.onChange != nil {
-		e.onChange()
-	}
+	e.changed()
 }
 
 // SaveEdit saves the current buffer state to the undo stack.
@@ -1148,6 +1279,10 @@ func (e *editor) Undo() {
 	if len(e.undoStack) == 0 {
 		return
 	}
+	e.clearSuggest()
+
+	// the snippet fields can't follow the restored text
+	e.snippet = nil
 
 	// Save current state to redo stack
 	bufCopy := make([][]rune, len(e.buf))
@@ -1173,9 +1308,7 @@ func (e *editor) Undo() {
 	e.adjustCol()
 	e.EnsureVisible(e.Pos.Row)
 	e.MergeNext = false
-	if e.onChange != nil {
-		e.onChange()
-	}
+	e.changed()
 }
 
 // Redo reapplies an undone edit operation.
@@ -1183,6 +1316,9 @@ func (e *editor) Redo() {
 	if len(e.redoStack) == 0 {
 		return
 	}
+	e.clearSuggest()
+
+	e.snippet = nil
 
 	// Save current state to undo stack
 	bufCopy := make([][]rune, len(e.buf))
@@ -1208,71 +1344,78 @@ func (e *editor) Redo() {
 	e.adjustCol()
 	e.EnsureVisible(e.Pos.Row)
 	e.MergeNext = false
-	if e.onChange != nil {
-		e.onChange()
-	}
+	e.changed()
 }
 
-// updateInlineSuggest finds and sets the current inline suggestion.
-func (e *editor) updateInlineSuggest() {
-	if !e.InlineSuggest || e.Suggester == nil {
+// PrefixAtCursor returns the partial word that ends at the cursor,
+// and the column where it starts. It fails in the middle of a word.
+func (e *editor) PrefixAtCursor() (start int, prefix string, ok bool) {
+	if e.Pos.Row >= len(e.buf) {
 		return
 	}
-
-	e.currentSuggest = ""
-
-	if e.Pos.Row >= len(e.buf) || e.Pos.Col == 0 {
-		return
-	}
-
 	line := e.buf[e.Pos.Row]
-	if e.Pos.Col > len(line) {
+	if e.Pos.Col == 0 || e.Pos.Col > len(line) {
 		return
 	}
 
 	isWordChar := func(r rune) bool {
 		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
 	}
-
-	// Don't suggest if cursor is in the middle of a word
 	if e.Pos.Col < len(line) && isWordChar(line[e.Pos.Col]) {
 		return
 	}
 
-	// Find word start
-	wordStart := e.Pos.Col
-	for wordStart > 0 && isWordChar(line[wordStart-1]) {
-		wordStart--
+	start = e.Pos.Col
+	for start > 0 && isWordChar(line[start-1]) {
+		start--
 	}
-
-	if wordStart == e.Pos.Col {
+	if start == e.Pos.Col {
 		return
 	}
+	return start, string(line[start:e.Pos.Col]), true
+}
 
-	prefix := string(line[wordStart:e.Pos.Col])
-	if len(prefix) == 0 {
+// updateInlineSuggest asks the Suggester for a suggestion in the background,
+// the result is shown when it arrives, unless the prefix changed meanwhile.
+func (e *editor) updateInlineSuggest() {
+	if !e.InlineSuggest || e.Suggester == nil || e.Post == nil {
 		return
 	}
 
-	// Call suggester with timeout to prevent blocking
-	timeout := e.SuggesterTimeout
-	if timeout == 0 {
-		timeout = 100 * time.Millisecond
+	e.clearSuggest()
+	_, prefix, ok := e.PrefixAtCursor()
+	if !ok {
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	resultCh := make(chan string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	if e.SuggesterTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), e.SuggesterTimeout)
+	}
+	e.cancelSuggest = cancel
+	gen := e.suggestGen
 	go func() {
-		resultCh <- e.Suggester(ctx, prefix)
+		result := e.Suggester(ctx, prefix)
+		e.Post(func() {
+			if gen != e.suggestGen {
+				return
+			}
+			e.cancelSuggest = nil
+			cancel()
+			if _, p, ok := e.PrefixAtCursor(); ok && p == prefix {
+				e.currentSuggest = result
+			}
+		})
 	}()
+}
 
-	select {
-	case result := <-resultCh:
-		e.currentSuggest = result
-	case <-ctx.Done():
-		// Timeout - don't set suggestion
+// clearSuggest hides the inline suggestion and abandons a pending one.
+func (e *editor) clearSuggest() {
+	e.currentSuggest = ""
+	e.suggestGen++
+	if e.cancelSuggest != nil {
+		e.cancelSuggest()
+		e.cancelSuggest = nil
 	}
 }
 
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cansyan/co/ui"
 )
@@ -843,3 +845,103 @@ func TestTextEditor_FindOpeningBracket(t *testing.T) {
 		})
 	}
 }
+
+func TestInlineSuggestAsync(t *testing.T) {
+	e := newEditor()
+	e.InlineSuggest = true
+	posted := make(chan func(), 2)
+	e.Post = func(fn func()) { posted <- fn }
+	e.Suggester = func(ctx context.Context, prefix string) string {
+		return prefix + "_suffix"
+	}
+
+	e.InsertRune('a')
+	if e.currentSuggest != "" {
+		t.Fatalf("suggestion applied before the UI goroutine ran it: %q", e.currentSuggest)
+	}
+	e.InsertRune('b')
+
+	// the result for "a" is stale, whatever order the results arrive in
+	for range 2 {
+		(<-posted)()
+	}
+	if want := "ab_suffix"; e.currentSuggest != want {
+		t.Errorf("currentSuggest = %q, want %q", e.currentSuggest, want)
+	}
+
+	e.InsertRune('c')
+	e.MoveLeft()
+	(<-posted)()
+	if e.currentSuggest != "" {
+		t.Errorf("suggestion applied after the cursor moved: %q", e.currentSuggest)
+	}
+}
+
+func TestInlineSuggestSlow(t *testing.T) {
+	e := newEditor()
+	e.InlineSuggest = true
+	posted := make(chan func(), 1)
+	e.Post = func(fn func()) { posted <- fn }
+	cancelled := make(chan bool, 1)
+	e.Suggester = func(ctx context.Context, prefix string) string {
+		// a suggester slower than any fixed timeout would allow
+		select {
+		case <-time.After(200 * time.Millisecond):
+			return prefix + "_slow"
+		case <-ctx.Done():
+			cancelled <- true
+			return ""
+		}
+	}
+
+	e.InsertRune('a')
+	(<-posted)()
+	if want := "a_slow"; e.currentSuggest != want {
+		t.Errorf("currentSuggest = %q, want %q", e.currentSuggest, want)
+	}
+
+	// moving the cursor cancels the call
+	e.InsertRune('b')
+	e.SetCursor(0, 0)
+	select {
+	case <-cancelled:
+	case <-time.After(100 * time.Millisecond):
+		t.Error("suggester call not cancelled when the cursor moved")
+	}
+}
+
+func TestTextEditor_DecorationStyles(t *testing.T) {
+	e := newEditor()
+	e.SetText("abc\ndefg\nhi")
+	hl := ui.Style{BG: "#111111"}
+	fg := ui.Style{FG: "#222222"}
+	e.SetDecorations("find", []Decoration{
+		{Start: Pos{Row: 0, Col: 1}, End: Pos{Row: 0, Col: 2}, Style: hl},
+		{Start: Pos{Row: 0, Col: 3}, End: Pos{Row: 1, Col: 1}, Style: hl},
+	})
+	e.SetDecorations("other", []Decoration{
+		{Start: Pos{Row: 1, Col: 0}, End: Pos{Row: 1, Col: 3}, Style: fg},
+	})
+
+	both := ui.Style{FG: "#222222", BG: "#111111"}
+	tests := []struct {
+		row  int
+		want []ui.Style
+	}{
+		{0, []ui.Style{{}, hl, {}, hl}},
+		{1, []ui.Style{both, fg, fg, {}, {}}},
+		{2, nil},
+	}
+	for _, tt := range tests {
+		got := e.decorationStyles(tt.row, len(e.buf[tt.row]))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("row %d = %v, want %v", tt.row, got, tt.want)
+		}
+	}
+
+	e.SetDecorations("find", nil)
+	e.SetDecorations("other", nil)
+	if got := e.decorationStyles(0, 3); got != nil {
+		t.Errorf("after clearing = %v, want nil", got)
+	}
+}
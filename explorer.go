@@ -0,0 +1,504 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cansyan/co/ignore"
+	"github.com/cansyan/co/ui"
+	"github.com/gdamore/tcell/v2"
+)
+
+// explorerWidth is the width of the sidebar, in columns.
+const explorerWidth = 30
+
+// Explorer is the sidebar showing the tree of the workspace.
+// Directories are read as they are expanded, and read again when the
+// file index sees the tree change.
+type Explorer struct {
+	*ui.Tree
+	a       *App
+	root    string // empty until first shown
+	ignore  *ignore.Matcher
+	changes map[string]string // git's mark of changed files and their directories, by absolute path
+	gen     int               // of the last look at the changes, to drop stale ones
+}
+
+func newExplorer(a *App) *Explorer {
+	x := &Explorer{Tree: new(ui.Tree), a: a}
+	x.OnExpand = func(n *ui.TreeNode) {
+		n.Children = x.children(n.Value.(string))
+	}
+	x.OnSelect = func(n *ui.TreeNode) {
+		if err := a.openFile(n.Value.(string)); err != nil {
+			a.setStatus(err.Error(), 5*time.Second)
+			return
+		}
+		a.requestFocus()
+	}
+	return x
+}
+
+func (x *Explorer) Size() (int, int) { return explorerWidth, 1 }
+
+// Layout makes the explorer, rather than the tree, what the manager
+// focuses and sends keys to, so the keymap sees them first.
+func (x *Explorer) Layout(r ui.Rect) *ui.Node {
+	n := x.Tree.Layout(r)
+	n.Element = x
+	return n
+}
+
+func (x *Explorer) HandleKey(ev *tcell.EventKey) bool {
+	if x.a.handleKey(ev) {
+		return true
+	}
+	return x.Tree.HandleKey(ev)
+}
+
+// children returns the nodes of the entries of dir, directories first.
+func (x *Explorer) children(dir string) []*ui.TreeNode {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		x.a.setStatus(err.Error(), 5*time.Second)
+		return nil
+	}
+	slices.SortStableFunc(entries, func(a, b fs.DirEntry) int {
+		if a.IsDir() != b.IsDir() {
+			if a.IsDir() {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(strings.ToLower(a.Name()), strings.ToLower(b.Name()))
+	})
+
+	nodes := make([]*ui.TreeNode, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		n := &ui.TreeNode{
+			Name:   entry.Name(),
+			Value:  filepath.Join(dir, entry.Name()),
+			Branch: entry.IsDir(),
+		}
+		x.decorate(n)
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// decorate dims what git ignores and marks what it sees changed.
+func (x *Explorer) decorate(n *ui.TreeNode) {
+	path := n.Value.(string)
+	n.Style = ui.Style{}
+	if rel, err := filepath.Rel(x.root, path); err == nil && x.ignore.Ignored(rel, n.Branch) {
+		n.Style.FG = ui.Theme.Syntax.Comment.FG
+	}
+	n.Mark = x.changes[path]
+	switch n.Mark {
+	case "U":
+		n.MarkStyle = ui.Style{FG: ui.Theme.Syntax.String.FG}
+	default:
+		n.MarkStyle = ui.Style{FG: ui.Theme.Syntax.Keyword.FG}
+	}
+}
+
+// walk calls fn on the nodes loaded, parents before their children.
+func (x *Explorer) walk(fn func(n *ui.TreeNode)) {
+	var walk func(nodes []*ui.TreeNode)
+	walk = func(nodes []*ui.TreeNode) {
+		for _, n := range nodes {
+			fn(n)
+			walk(n.Children)
+		}
+	}
+	walk(x.Roots)
+}
+
+// refresh reads the tree again, keeping the directories expanded and
+// the selection.
+func (x *Explorer) refresh() {
+	expanded := make(map[string]bool)
+	x.walk(func(n *ui.TreeNode) {
+		if n.Expanded {
+			expanded[n.Value.(string)] = true
+		}
+	})
+	var selected string
+	if n := x.Selected(); n != nil {
+		selected = n.Value.(string)
+	}
+
+	x.ignore = ignore.New(x.root)
+	x.Roots = x.children(x.root)
+	x.walk(func(n *ui.TreeNode) {
+		// expanding loads the children, which the walk goes on to
+		if expanded[n.Value.(string)] {
+			x.Expand(n)
+		}
+	})
+	if n := x.find(selected); n != nil {
+		x.Select(n)
+	}
+	x.updateChanges()
+}
+
+// find returns the node of path if it is loaded.
+func (x *Explorer) find(path string) *ui.TreeNode {
+	var found *ui.TreeNode
+	x.walk(func(n *ui.TreeNode) {
+		if found == nil && n.Value.(string) == path {
+			found = n
+		}
+	})
+	return found
+}
+
+// reveal expands the directories down to path and selects it,
+// reports false if path is not in the tree.
+func (x *Explorer) reveal(path string) bool {
+	rel, err := filepath.Rel(x.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	nodes := x.Roots
+	dir := x.root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, name)
+		i := slices.IndexFunc(nodes, func(n *ui.TreeNode) bool { return n.Value.(string) == dir })
+		if i < 0 {
+			return false
+		}
+		n := nodes[i]
+		if dir == path {
+			return x.Select(n)
+		}
+		x.Expand(n)
+		nodes = n.Children
+	}
+	return false
+}
+
+// updateChanges asks git which files changed, in the background.
+func (x *Explorer) updateChanges() {
+	x.gen++
+	gen, root := x.gen, x.root
+	go func() {
+		changes, err := gitChanges(root)
+		if err != nil {
+			// not a repository, or no git
+			changes = nil
+		}
+		x.a.manager.Post(func() {
+			if gen != x.gen {
+				return
+			}
+			x.changes = changes
+			x.walk(x.decorate)
+		})
+	}()
+}
+
+// gitChanges returns "M" for the modified files under root and "U" for
+// the untracked ones, by absolute path; their directories are marked "•".
+func gitChanges(root string) (map[string]string, error) {
+	cmd := exec.Command("git", "ls-files", "--modified", "--others", "--exclude-standard", "-t", "-z")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]string)
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// a tag, a space, then the path relative to root
+		tag, rel, ok := strings.Cut(entry, " ")
+		if !ok {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		mark := "M"
+		if tag == "?" {
+			mark = "U"
+		}
+		// a file both modified and deleted is listed twice
+		if changes[path] != "U" {
+			changes[path] = mark
+		}
+		for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+			changes[dir] = "•"
+		}
+	}
+	return changes, nil
+}
+
+// targetDir returns the directory to create entries in: the selected
+// directory, or the one of the selected file.
+func (x *Explorer) targetDir() string {
+	n := x.Selected()
+	if n == nil {
+		return x.root
+	}
+	if n.Branch {
+		return n.Value.(string)
+	}
+	return filepath.Dir(n.Value.(string))
+}
+
+// rootDir returns the directory the finder and the explorer list.
+func (a *App) rootDir() string {
+	if a.files != nil {
+		return a.files.root
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// explorerFocused reports whether the explorer has keyboard focus.
+func (a *App) explorerFocused() bool {
+	return a.showExplorer && a.manager.Focused() == ui.Element(a.explorer)
+}
+
+// openExplorer shows the explorer and focuses it.
+func (a *App) openExplorer() {
+	x := a.explorer
+	if x.root == "" {
+		x.root = a.rootDir()
+		x.refresh()
+	}
+	a.showExplorer = true
+	a.manager.SetFocus(x)
+}
+
+// toggleExplorer shows or hides the explorer.
+func (a *App) toggleExplorer() {
+	if !a.showExplorer {
+		a.openExplorer()
+		return
+	}
+	focused := a.explorerFocused()
+	a.showExplorer = false
+	if focused {
+		a.requestFocus()
+	}
+}
+
+// focusExplorer moves the focus between the explorer and the editor.
+func (a *App) focusExplorer() {
+	if a.explorerFocused() {
+		a.requestFocus()
+		return
+	}
+	a.openExplorer()
+}
+
+// revealActiveFile shows the file of the active tab in the explorer.
+func (a *App) revealActiveFile() {
+	if len(a.tabs) == 0 {
+		return
+	}
+	path := a.tabs[a.activeTab].path
+	a.openExplorer()
+	if !a.explorer.reveal(path) {
+		a.setStatus(filepath.Base(path)+" is not in "+a.explorer.root, 5*time.Second)
+	}
+}
+
+// explorerCreate asks for a name and creates a file, or a directory, in
+// the directory selected. A name with slashes creates the directories
+// in between.
+func (a *App) explorerCreate(dir bool) {
+	x := a.explorer
+	parent := x.targetDir()
+	label := "New file: "
+	if dir {
+		label = "New folder: "
+	}
+	a.promptName(label, "", func(name string) {
+		if name == "" {
+			return
+		}
+		path := filepath.Join(parent, name)
+		if err := createEntry(path, dir); err != nil {
+			a.setStatus(err.Error(), 5*time.Second)
+			return
+		}
+		x.refresh()
+		x.reveal(path)
+		if dir {
+			return
+		}
+		if err := a.openFile(path); err != nil {
+			a.setStatus(err.Error(), 5*time.Second)
+			return
+		}
+		a.requestFocus()
+	})
+}
+
+// createEntry creates an empty file, or a directory, at path.
+// It fails if there is something there already.
+func createEntry(path string, dir bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if dir {
+		return os.Mkdir(path, 0755)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// explorerRename asks for a new name of the selected entry and renames it,
+// the tabs of the files renamed follow.
+func (a *App) explorerRename() {
+	x := a.explorer
+	n := x.Selected()
+	if n == nil {
+		return
+	}
+	old := n.Value.(string)
+	a.promptName("Rename to: ", n.Name, func(name string) {
+		if name == "" || name == n.Name {
+			return
+		}
+		path := filepath.Join(filepath.Dir(old), name)
+		if err := renameEntry(old, path); err != nil {
+			a.setStatus(err.Error(), 5*time.Second)
+			return
+		}
+		a.movePaths(old, path)
+		x.refresh()
+		x.reveal(path)
+	})
+}
+
+var errExists = errors.New("already exists")
+
+// renameEntry renames old to path, which must not exist.
+func renameEntry(old, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s %w", filepath.Base(path), errExists)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Rename(old, path)
+}
+
+// movePaths points the tabs, the jump history and the recent files at old,
+// or inside it, to where it moved. A tab whose extension changed is set up
+// for its new language.
+func (a *App) movePaths(old, path string) {
+	move := func(p string) string {
+		if p == old {
+			return path
+		}
+		if rest, ok := strings.CutPrefix(p, old+string(filepath.Separator)); ok {
+			return filepath.Join(path, rest)
+		}
+		return p
+	}
+	for _, t := range a.tabs {
+		path := move(t.path)
+		if filepath.Ext(path) != filepath.Ext(t.path) {
+			t.editor.setLanguage(path)
+		}
+		t.path = path
+	}
+	for i := range a.history {
+		a.history[i].path = move(a.history[i].path)
+	}
+	for i := range a.recent {
+		a.recent[i].Path = move(a.recent[i].Path)
+	}
+}
+
+// explorerDelete deletes the selected entry after confirming. The tabs of
+// the files deleted are kept, with their text unsaved.
+func (a *App) explorerDelete() {
+	x := a.explorer
+	n := x.Selected()
+	if n == nil {
+		return
+	}
+	path := n.Value.(string)
+	question := fmt.Sprintf("Delete %s?", n.Name)
+	if n.Branch {
+		question = fmt.Sprintf("Delete %s and everything in it?", n.Name)
+	}
+
+	deleteBtn := &ui.Button{
+		Text: "Delete",
+		OnClick: func() {
+			a.manager.CloseOverlay()
+			if err := os.RemoveAll(path); err != nil {
+				a.setStatus(err.Error(), 5*time.Second)
+				return
+			}
+			for _, t := range a.tabs {
+				if t.path == path || strings.HasPrefix(t.path, path+string(filepath.Separator)) {
+					t.editor.Dirty = true
+				}
+			}
+			x.refresh()
+		},
+		Style: ui.Style{BG: ui.Theme.Selection},
+	}
+	view := ui.Border(ui.VStack(
+		ui.PadH(ui.NewText(question), 1),
+		ui.PadH(ui.HStack(
+			ui.NewButton("Cancel", a.manager.CloseOverlay),
+			ui.Spacer,
+			deleteBtn,
+		), 2),
+	).Spacing(1))
+	a.manager.Overlay(view, "top")
+}
+
+// promptName asks for a name, starting from text.
+func (a *App) promptName(label, text string, commit func(name string)) {
+	run := func(name string) {
+		a.manager.CloseOverlay()
+		commit(strings.TrimSpace(name))
+	}
+	input := &ui.Input{OnCommit: run}
+	input.SetText(text)
+	// select the name without its extension, to type a new one
+	stem := strings.TrimSuffix(text, filepath.Ext(text))
+	if stem == "" {
+		stem = text
+	}
+	input.Select(0, len([]rune(stem)))
+
+	okBtn := &ui.Button{
+		Text:    "OK",
+		OnClick: func() { run(input.String()) },
+		Style:   ui.Style{BG: ui.Theme.Selection},
+	}
+	dialog := ui.Frame(ui.Border(ui.VStack(
+		ui.PadH(ui.HStack(
+			ui.NewText(label),
+			ui.Grow(input),
+		), 1),
+		ui.PadH(ui.HStack(
+			ui.NewButton("Cancel", a.manager.CloseOverlay),
+			ui.Spacer,
+			okBtn,
+		), 4),
+	).Spacing(1)), 50, 0)
+	a.manager.Overlay(dialog, "top")
+	a.manager.SetFocus(input)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestExplorer(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore": "*.log\n",
+		"b.go":       "",
+		"A.txt":      "",
+		"debug.log":  "",
+		"sub/c.go":   "",
+		".git/HEAD":  "",
+	})
+	a := newApp(ui.NewManager())
+	x := a.explorer
+	x.root = root
+	x.refresh()
+
+	names := func(nodes []*ui.TreeNode) []string {
+		var s []string
+		for _, n := range nodes {
+			s = append(s, n.Name)
+		}
+		return s
+	}
+	// directories first, then by name ignoring case, without .git
+	want := []string{"sub", ".gitignore", "A.txt", "b.go", "debug.log"}
+	if got := names(x.Roots); !reflect.DeepEqual(got, want) {
+		t.Errorf("roots = %q, want %q", got, want)
+	}
+	for _, n := range x.Roots {
+		ignored := n.Style.FG != ""
+		if ignored != (n.Name == "debug.log") {
+			t.Errorf("%s dimmed as ignored = %v", n.Name, ignored)
+		}
+	}
+
+	c := filepath.Join(root, "sub", "c.go")
+	if !x.reveal(c) {
+		t.Fatal("reveal(sub/c.go) = false")
+	}
+	if n := x.Selected(); n == nil || n.Value != c {
+		t.Fatalf("selected %v after reveal, want %s", n, c)
+	}
+
+	// a refresh sees new files, and keeps sub expanded and c.go selected
+	writeFiles(t, root, map[string]string{"sub/d.go": ""})
+	x.refresh()
+	sub := x.Roots[0]
+	if !sub.Expanded {
+		t.Fatal("sub collapsed by refresh")
+	}
+	if got, want := names(sub.Children), []string{"c.go", "d.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sub children = %q, want %q", got, want)
+	}
+	if n := x.Selected(); n == nil || n.Value != c {
+		t.Errorf("selected %v after refresh, want %s", n, c)
+	}
+}
+
+func TestExplorerRename(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"sub/c.go": "",
+		"taken.go": "",
+	})
+	a := newApp(ui.NewManager())
+	a.newTab(filepath.Join(root, "sub", "c.go"))
+	a.newTab(filepath.Join(root, "subway.go"))
+
+	err := renameEntry(filepath.Join(root, "sub", "c.go"), filepath.Join(root, "taken.go"))
+	if !errors.Is(err, errExists) {
+		t.Errorf("renaming over a file: err = %v, want %v", err, errExists)
+	}
+
+	old, path := filepath.Join(root, "sub"), filepath.Join(root, "pkg")
+	if err := renameEntry(old, path); err != nil {
+		t.Fatal(err)
+	}
+	a.movePaths(old, path)
+	if got, want := a.tabs[0].path, filepath.Join(path, "c.go"); got != want {
+		t.Errorf("tab path = %s, want %s", got, want)
+	}
+	if got, want := a.tabs[1].path, filepath.Join(root, "subway.go"); got != want {
+		t.Errorf("unrelated tab path = %s, want %s", got, want)
+	}
+
+	// a new extension, and the recent files follow the move
+	old, path = filepath.Join(root, "taken.go"), filepath.Join(root, "notes.md")
+	a.newTab(old)
+	a.recent = []recentEntry{{Path: old, Row: 3}}
+	if err := renameEntry(old, path); err != nil {
+		t.Fatal(err)
+	}
+	a.movePaths(old, path)
+	if got := a.recent[0]; got.Path != path || got.Row != 3 {
+		t.Errorf("recent entry = %+v, want it at %s", got, path)
+	}
+	e := a.tabs[2].editor
+	if e.Highlighter == nil || !reflect.DeepEqual(e.snippets, snippetsFor("markdown")) {
+		t.Errorf("tab renamed to .md not set up for markdown")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cansyan/co/ignore"
+	"github.com/cansyan/co/ui"
+)
+
+// The file index lists the files of the working tree for the palette.
+// It is built in the background and rebuilt when the tree changes. There
+// is no file watcher in the standard library, so it polls the modification
+// time of the directories it walked, which changes as entries are created,
+// removed or renamed in them.
+
+const (
+	indexPollInterval = 2 * time.Second
+	maxIndexedFiles   = 200_000
+)
+
+var errTooManyFiles = errors.New("too many files")
+
+// fileIndex holds the files under root that git doesn't ignore.
+type fileIndex struct {
+	root string
+
+	mu    sync.Mutex
+	files []string // relative to root, in walk order; replaced, never changed
+
+	// modification times of the directories walked and of the ignore
+	// files, only touched by the goroutine that builds the index
+	stamps map[string]time.Time
+}
+
+func newFileIndex(root string) *fileIndex {
+	return &fileIndex{root: root}
+}
+
+// list returns the files indexed so far, nil before the first build.
+func (x *fileIndex) list() []string {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.files
+}
+
+// build walks the tree and replaces the index. A tree too large to index
+// keeps the files found up to the limit.
+func (x *fileIndex) build(ctx context.Context) error {
+	var files []string
+	stamps := make(map[string]time.Time)
+	err := walkTree(ctx, x.root, func(path string, d fs.DirEntry) {
+		if info, err := d.Info(); err == nil {
+			stamps[path] = info.ModTime()
+		}
+	}, func(path, rel string, d fs.DirEntry) error {
+		// editing an ignore file changes it, not its directory
+		if d.Name() == ".gitignore" {
+			stamp(stamps, path)
+		}
+		files = append(files, rel)
+		if len(files) >= maxIndexedFiles {
+			return errTooManyFiles
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errTooManyFiles) {
+		return err
+	}
+	stamp(stamps, filepath.Join(x.root, ".git", "info", "exclude"))
+	stamp(stamps, ignore.GlobalExcludesFile())
+
+	x.mu.Lock()
+	x.files = files
+	x.mu.Unlock()
+	x.stamps = stamps
+	return nil
+}
+
+// stamp records the modification time of the file at path, if it exists.
+func stamp(stamps map[string]time.Time, path string) {
+	if info, err := os.Stat(path); err == nil {
+		stamps[path] = info.ModTime()
+	}
+}
+
+// changed reports whether a directory walked, or an ignore file, changed
+// since the last build.
+func (x *fileIndex) changed() bool {
+	for path, t := range x.stamps {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// run builds the index, then rebuilds it whenever the tree changes, until
+// ctx is done. It calls updated after each build.
+func (x *fileIndex) run(ctx context.Context, updated func()) {
+	ticker := time.NewTicker(indexPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := x.build(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Print(err)
+		} else {
+			updated()
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if x.changed() {
+				break
+			}
+		}
+	}
+}
+
+// indexFiles starts indexing the files under root for the palette.
+func (a *App) indexFiles(root string) {
+	a.files = newFileIndex(root)
+	go a.files.run(context.Background(), func() {
+		a.manager.Post(func() {
+			a.refreshPalette("")
+			if a.explorer.root != "" {
+				a.explorer.refresh()
+			}
+		})
+	})
+}
+
+// refreshPalette lists the items again in the open palette if it is in
+// mode, "" for finding files, keeping the item selected.
+func (a *App) refreshPalette(mode string) {
+	p := a.palette
+	if p == nil || a.manager.Focused() != ui.Element(p) || p.mode() != mode {
+		return
+	}
+
+	var selected any
+	if i := p.list.Index; i >= 0 && i < p.list.Len() {
+		selected = p.list.Items[i].Value
+	}
+	p.input.OnChange()
+	for i, item := range p.list.Items {
+		if item.Value == selected {
+			p.list.Select(i)
+			break
+		}
+	}
+}
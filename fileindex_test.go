@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestFileIndex(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":      "*.log\n",
+		"main.go":         "",
+		"ui/component.go": "",
+		"ui/debug.log":    "",
+		".git/HEAD":       "",
+	})
+	// so that changes made right after the build show
+	past := time.Now().Add(-time.Hour)
+	for _, dir := range []string{root, filepath.Join(root, "ui")} {
+		if err := os.Chtimes(dir, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	x := newFileIndex(root)
+	if x.list() != nil {
+		t.Errorf("list() before build = %q, want nil", x.list())
+	}
+	if err := x.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".gitignore", "main.go", filepath.Join("ui", "component.go")}
+	if got := x.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("list() = %q, want %q", got, want)
+	}
+	if x.changed() {
+		t.Error("changed() right after the build = true, want false")
+	}
+
+	writeFiles(t, root, map[string]string{"ui/list.go": ""})
+	if !x.changed() {
+		t.Fatal("changed() after adding a file = false, want true")
+	}
+	if err := x.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{".gitignore", "main.go", filepath.Join("ui", "component.go"), filepath.Join("ui", "list.go")}
+	if got := x.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("list() after the change = %q, want %q", got, want)
+	}
+}
+
+func TestFileSearchMode(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go":         "",
+		"ui/component.go": "",
+		"ui/theme.go":     "",
+	})
+	a := newApp(ui.NewManager())
+	a.files = newFileIndex(root)
+	if err := a.files.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	a.showPalette("uicomp")
+	items := a.palette.list.Items
+	if len(items) != 1 {
+		t.Fatalf("items = %v, want 1", items)
+	}
+	want := ui.ListItem{
+		Name:    filepath.Join("ui", "component.go"),
+		Value:   filepath.Join(root, "ui", "component.go"),
+		Matches: []int{0, 1, 3, 4, 5, 6},
+	}
+	if !reflect.DeepEqual(items[0], want) {
+		t.Errorf("item = %+v, want %+v", items[0], want)
+	}
+}
+
+func TestIndexFilesBeforeStart(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.go": "", "b.go": ""})
+	a := newApp(ui.NewManager())
+	a.newTab("untitled")
+	// as co ./dir does: the palette opens while the index is built,
+	// the refresh posted then waits for the event loop
+	a.indexFiles(root)
+	a.showPalette("")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for a.palette.list.Len() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("palette lists %v, want both files", a.palette.list.Items)
+		}
+		if !a.manager.RunPosted() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
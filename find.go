@@ -0,0 +1,611 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cansyan/co/ui"
+	"github.com/gdamore/tcell/v2"
+)
+
+// findOptions control how a query matches text.
+type findOptions struct {
+	regex         bool // the query is a regular expression
+	caseSensitive bool
+	wholeWord     bool // matches must not be part of a longer word
+	smartCase     bool // case-sensitive only if the query has upper case letters
+}
+
+// matcher finds the matches of a compiled query.
+type matcher struct {
+	re        *regexp.Regexp
+	regex     bool
+	wholeWord bool
+}
+
+// compile turns a query into a matcher, ^ and $ match at line breaks.
+func (o findOptions) compile(query string) (*matcher, error) {
+	pattern := query
+	if !o.regex {
+		pattern = regexp.QuoteMeta(query)
+	}
+	flags := "(?im)"
+	if o.caseSensitive || o.smartCase && strings.ContainsFunc(query, unicode.IsUpper) {
+		flags = "(?m)"
+	}
+	re, err := regexp.Compile(flags + pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &matcher{re: re, regex: o.regex, wholeWord: o.wholeWord}, nil
+}
+
+// match is the text range a query matched, it may span lines.
+type match struct {
+	start, end Pos
+}
+
+// maxMatches bounds the work and memory of a search,
+// a pattern like "." would otherwise match every character.
+const maxMatches = 100_000
+
+// findAll returns the non-empty matches in content.
+func (m *matcher) findAll(content string) []match {
+	var matches []match
+	var pos Pos
+	off := 0
+	// advance moves pos forward to the byte offset end,
+	// offsets only grow since matches don't overlap.
+	advance := func(end int) Pos {
+		for off < end {
+			r, size := utf8.DecodeRuneInString(content[off:])
+			if r == '\n' {
+				pos.Row++
+				pos.Col = 0
+			} else {
+				pos.Col++
+			}
+			off += size
+		}
+		return pos
+	}
+
+	m.eachMatch(content, maxMatches, func(loc []int) bool {
+		start := advance(loc[0])
+		end := advance(loc[1])
+		matches = append(matches, match{start: start, end: end})
+		return len(matches) < maxMatches
+	})
+	return matches
+}
+
+// first returns the indexes of the first match in content that starts at
+// off or after it, or nil.
+func (m *matcher) first(content string, off int) []int {
+	var loc []int
+	m.eachMatch(content, -1, func(l []int) bool {
+		if l[0] < off {
+			return true
+		}
+		loc = l
+		return false
+	})
+	return loc
+}
+
+// eachMatch calls fn with the submatch indexes of the non-empty matches in
+// content, in order, until fn returns false, looking at n matches at most
+// at a time. A match rejected as part of a longer word may hide a whole
+// word overlapping it, then the search goes on from its next rune, where ^
+// and \b no longer see the text before.
+func (m *matcher) eachMatch(content string, n int, fn func(loc []int) bool) {
+	base := 0
+	for {
+		restart := -1
+		for _, loc := range m.re.FindAllStringSubmatchIndex(content[base:], n) {
+			for i := range loc {
+				if loc[i] >= 0 {
+					loc[i] += base
+				}
+			}
+			if loc[0] == loc[1] {
+				// an empty match has nothing to select
+				continue
+			}
+			if m.wholeWord && !isWordBounded(content, loc[0], loc[1]) {
+				_, size := utf8.DecodeRuneInString(content[loc[0]:])
+				next := m.re.FindStringIndex(content[loc[0]+size:])
+				if next != nil && loc[0]+size+next[0] < loc[1] {
+					restart = loc[0] + size
+					break
+				}
+				continue
+			}
+			if !fn(loc) {
+				return
+			}
+		}
+		if restart < 0 {
+			return
+		}
+		base = restart
+	}
+}
+
+// replacement replaces content[start:end] with text, offsets are in bytes.
+type replacement struct {
+	start, end int
+	text       string
+}
+
+// replacements returns the replacement of every match in content,
+// $1 or ${name} in repl refer to the groups of a regex.
+func (m *matcher) replacements(content, repl string) []replacement {
+	var rs []replacement
+	m.eachMatch(content, -1, func(loc []int) bool {
+		text := repl
+		if m.regex {
+			text = string(m.re.ExpandString(nil, repl, content, loc))
+		}
+		rs = append(rs, replacement{start: loc[0], end: loc[1], text: text})
+		return true
+	})
+	return rs
+}
+
+// applyReplacements returns content with rs applied, rs must be in order.
+func applyReplacements(content string, rs []replacement) string {
+	var sb strings.Builder
+	last := 0
+	for _, r := range rs {
+		sb.WriteString(content[last:r.start])
+		sb.WriteString(r.text)
+		last = r.end
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// replaceAll replaces every match in content, and reports how many there were.
+func (m *matcher) replaceAll(content, repl string) (string, int) {
+	rs := m.replacements(content, repl)
+	return applyReplacements(content, rs), len(rs)
+}
+
+// isWordBounded reports whether content[start:end] is not preceded
+// or followed by a word character.
+func isWordBounded(content string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(content[:start])
+	after, _ := utf8.DecodeRuneInString(content[end:])
+	return !isAlphaNumeric(before) && !isAlphaNumeric(after)
+}
+
+// patternError shortens regexp errors to fit in the find bar,
+// the expression is left out as it includes the flags added by compile.
+func patternError(err error) string {
+	var serr *syntax.Error
+	if errors.As(err, &serr) {
+		return serr.Code.String()
+	}
+	return err.Error()
+}
+
+type SearchBar struct {
+	a           *App
+	input       *proxyInput
+	replace     *replaceField
+	btnRegex    *ui.Button
+	btnCase     *ui.Button
+	btnWord     *ui.Button
+	btnSmart    *ui.Button
+	btnReplace  *ui.Button
+	btnAll      *ui.Button
+	showReplace bool
+	btnPrev     *ui.Button
+	btnNext     *ui.Button
+	closeBtn    *ui.Button
+	opts        findOptions
+	matches     []match
+	activeIndex int   // -1 表示尚未進行導航定位
+	err         error // the query is not a valid pattern
+
+	highlighted *Editor // the editor showing the matches
+
+	scanning   bool // a background search is running
+	scanGen    int  // identifies the latest search
+	pendingNav int  // navigation waiting for the search, 1 forward, -1 backward
+}
+
+func NewSearchBar(r *App) *SearchBar {
+	sb := &SearchBar{a: r, activeIndex: -1}
+	sb.input = &proxyInput{
+		Input:  new(ui.Input),
+		parent: sb,
+	}
+	sb.input.OnChange = sb.scan
+	sb.input.History = r.inputHistory("find")
+	sb.replace = &replaceField{sb: sb}
+	sb.replace.input = &proxyInput{Input: new(ui.Input), parent: sb.replace}
+	sb.replace.input.History = r.inputHistory("replace")
+
+	sb.btnRegex = ui.NewButton(".*", func() { sb.toggle(&sb.opts.regex) })
+	sb.btnCase = ui.NewButton("Aa", func() { sb.toggle(&sb.opts.caseSensitive) })
+	sb.btnWord = ui.NewButton("|w|", func() { sb.toggle(&sb.opts.wholeWord) })
+	sb.btnSmart = ui.NewButton("Aa?", func() { sb.toggle(&sb.opts.smartCase) })
+	sb.btnPrev = ui.NewButton("↑", func() { sb.navigate(false) })
+	sb.btnNext = ui.NewButton("↓", func() { sb.navigate(true) })
+	sb.closeBtn = ui.NewButton("✕", sb.a.closeSearch)
+	sb.btnReplace = ui.NewButton("Replace", sb.replaceOne)
+	sb.btnAll = ui.NewButton("Replace All", sb.replaceAll)
+	return sb
+}
+
+// toggle flips one of the options and searches again.
+func (sb *SearchBar) toggle(option *bool) {
+	*option = !*option
+	sb.scan()
+}
+
+// prepare starts a new search of the active editor,
+// ok is false if there is nothing to search for.
+func (sb *SearchBar) prepare() (content string, m *matcher, ok bool) {
+	sb.scanGen++
+	sb.scanning = false
+	sb.pendingNav = 0
+	sb.matches = nil
+	sb.activeIndex = -1
+	sb.err = nil
+
+	query := sb.input.String()
+	editor := sb.a.getEditor()
+	sb.highlight(editor)
+	if query == "" || editor == nil {
+		return "", nil, false
+	}
+	m, err := sb.opts.compile(query)
+	if err != nil {
+		sb.err = err
+		return "", nil, false
+	}
+	return editor.String(), m, true
+}
+
+// scan searches in the background, so a slow pattern on a large buffer
+// doesn't block typing. Results of an outdated query are dropped.
+func (sb *SearchBar) scan() {
+	content, m, ok := sb.prepare()
+	if !ok {
+		return
+	}
+
+	sb.scanning = true
+	gen := sb.scanGen
+	go func() {
+		matches := m.findAll(content)
+		sb.a.manager.Post(func() {
+			if gen != sb.scanGen {
+				return
+			}
+			sb.scanning = false
+			sb.matches = matches
+			sb.highlight(sb.highlighted)
+			if sb.pendingNav != 0 {
+				forward := sb.pendingNav > 0
+				sb.pendingNav = 0
+				sb.navigate(forward)
+			}
+		})
+	}()
+}
+
+// updateMatches searches right away.
+func (sb *SearchBar) updateMatches() {
+	content, m, ok := sb.prepare()
+	if ok {
+		sb.matches = m.findAll(content)
+		sb.highlight(sb.highlighted)
+	}
+}
+
+// highlight shows the matches in e, and clears them from the editor
+// that showed them before. A nil e just clears them.
+func (sb *SearchBar) highlight(e *Editor) {
+	if sb.highlighted != nil && sb.highlighted != e {
+		sb.highlighted.SetDecorations("find", nil)
+	}
+	sb.highlighted = e
+	if e == nil {
+		return
+	}
+
+	ds := make([]Decoration, len(sb.matches))
+	for i, m := range sb.matches {
+		ds[i] = Decoration{Start: m.start, End: m.end, Style: ui.Style{BG: ui.Theme.Highlight}}
+	}
+	e.SetDecorations("find", ds)
+}
+
+// bufferChanged searches again when the searched buffer changes,
+// so the matches keep up with the text.
+func (sb *SearchBar) bufferChanged(e *Editor) {
+	if sb.a.showSearch && e == sb.a.getEditor() {
+		sb.scan()
+	}
+}
+
+// 根據編輯器當前游標位置，找到最接近的匹配項索引
+func (sb *SearchBar) setInitialActiveIndex() {
+	if len(sb.matches) == 0 {
+		return
+	}
+
+	tab := sb.a.tabs[sb.a.activeTab]
+	e := tab.editor
+
+	// 尋找第一個在游標位置之後的匹配項
+	for i, m := range sb.matches {
+		if !m.start.Before(e.Pos) {
+			sb.activeIndex = i
+			return
+		}
+	}
+
+	// 若游標已在所有匹配項之後，則循環回第一個
+	sb.activeIndex = 0
+}
+
+func (sb *SearchBar) navigate(forward bool) {
+	if sb.scanning {
+		sb.pendingNav = 1
+		if !forward {
+			sb.pendingNav = -1
+		}
+		return
+	}
+
+	count := len(sb.matches)
+	if count == 0 {
+		return
+	}
+
+	// 首次導航：尋找最接近游標的匹配項
+	if sb.activeIndex == -1 {
+		sb.setInitialActiveIndex()
+		// 如果是向上找(Prev)，在定位後需再往前退一格
+		if !forward {
+			sb.activeIndex = (sb.activeIndex - 1 + count) % count
+		}
+	} else {
+		// 常規移動
+		if forward {
+			sb.activeIndex = (sb.activeIndex + 1) % count
+		} else {
+			sb.activeIndex = (sb.activeIndex - 1 + count) % count
+		}
+	}
+
+	sb.syncEditor()
+}
+
+func (sb *SearchBar) syncEditor() {
+	m := sb.matches[sb.activeIndex]
+	editor := sb.a.getEditor()
+	if editor == nil {
+		return
+	}
+	editor.CenterRow(m.start.Row)
+	editor.SetSelection(m.start, m.end)
+}
+
+func (sb *SearchBar) Layout(r ui.Rect) *ui.Node {
+	status := " 0/0 "
+	switch {
+	case sb.err != nil:
+		status = " " + patternError(sb.err) + " "
+	case sb.scanning:
+		status = " … "
+	case len(sb.matches) > 0:
+		displayIdx := sb.activeIndex + 1
+		more := ""
+		if len(sb.matches) == maxMatches {
+			more = "+"
+		}
+		status = fmt.Sprintf(" %d/%d%s ", displayIdx, len(sb.matches), more)
+	}
+
+	sb.btnRegex.Style = toggleStyle(sb.opts.regex)
+	sb.btnCase.Style = toggleStyle(sb.opts.caseSensitive)
+	sb.btnWord.Style = toggleStyle(sb.opts.wholeWord)
+	sb.btnSmart.Style = toggleStyle(sb.opts.smartCase)
+	view := ui.VStack(ui.HStack(
+		ui.PadH(ui.NewText("Find:   "), 1),
+		ui.Grow(sb.input),
+		ui.PadH(ui.NewText(status), 1),
+		sb.btnCase,
+		sb.btnWord,
+		sb.btnSmart,
+		sb.btnRegex,
+		sb.btnPrev,
+		sb.btnNext,
+		sb.closeBtn,
+	))
+	if sb.showReplace {
+		view.Append(ui.HStack(
+			ui.PadH(ui.NewText("Replace:"), 1),
+			ui.Grow(sb.replace),
+			sb.btnReplace,
+			sb.btnAll,
+		))
+	}
+	return &ui.Node{
+		Element:  sb,
+		Rect:     r,
+		Children: []*ui.Node{view.Layout(r)},
+	}
+}
+
+// toggleStyle highlights the buttons of options that are on.
+func toggleStyle(on bool) ui.Style {
+	if on {
+		return ui.Style{BG: ui.Theme.Border}
+	}
+	return ui.Style{}
+}
+
+func (sb *SearchBar) Size() (int, int) {
+	if sb.showReplace {
+		return 10, 2
+	}
+	return 10, 1
+}
+
+func (sb *SearchBar) Draw(s ui.Screen, r ui.Rect) {}
+
+func (sb *SearchBar) HandleKey(ev *tcell.EventKey) bool {
+	if sb.a.handleKey(ev) {
+		return true
+	}
+	return sb.input.HandleKey(ev)
+}
+
+func (sb *SearchBar) OnFocus() {
+	// make TextInput show cursor
+	sb.input.OnFocus()
+}
+func (sb *SearchBar) OnBlur() { sb.input.OnBlur() }
+
+// replaceOne replaces the current match and selects the next one.
+// Without a current match it only selects one, to review it first.
+func (sb *SearchBar) replaceOne() {
+	e := sb.a.getEditor()
+	if e == nil {
+		return
+	}
+	start, end, ok := e.Selection()
+	if sb.scanning || sb.activeIndex < 0 || !ok ||
+		sb.matches[sb.activeIndex] != (match{start: start, end: end}) {
+		sb.activeIndex = -1
+		sb.navigate(true)
+		return
+	}
+	m, err := sb.opts.compile(sb.input.String())
+	if err != nil {
+		return
+	}
+	// the match is replaced in the whole text, as replace all does,
+	// so anchors and groups see what is around it
+	off := e.byteOffset(start)
+	rs := m.replacements(e.String(), sb.replace.input.String())
+	i := slices.IndexFunc(rs, func(r replacement) bool { return r.start == off })
+	if i < 0 {
+		sb.activeIndex = -1
+		sb.navigate(true)
+		return
+	}
+	sb.remember()
+
+	e.SaveEdit()
+	e.MergeNext = false
+	e.InsertText(rs[i].text)
+	sb.scan()
+	sb.navigate(true)
+}
+
+// replaceAll replaces every match as a single undo step.
+func (sb *SearchBar) replaceAll() {
+	e := sb.a.getEditor()
+	if e == nil || sb.input.String() == "" {
+		return
+	}
+	m, err := sb.opts.compile(sb.input.String())
+	if err != nil {
+		return
+	}
+	sb.remember()
+	text, n := m.replaceAll(e.String(), sb.replace.input.String())
+	if n == 0 {
+		sb.a.setStatus("No matches", 3*time.Second)
+		return
+	}
+	e.ReplaceText(text)
+	sb.scan()
+	sb.a.setStatus(fmt.Sprintf("Replaced %d occurrences", n), 5*time.Second)
+}
+
+// remember adds the query, and the replacement if it is shown,
+// to the history of their inputs.
+func (sb *SearchBar) remember() {
+	sb.input.History.Add(sb.input.String())
+	if sb.showReplace {
+		sb.replace.input.History.Add(sb.replace.input.String())
+	}
+}
+
+// recall goes back (older) or forward in the history of the query if
+// the input allows it, otherwise to the previous or next match.
+func (sb *SearchBar) recall(older bool) {
+	in := sb.input
+	switch {
+	case older && in.CanRecall() && in.RecallPrev():
+	case !older && in.RecallNext():
+	default:
+		sb.navigate(!older)
+	}
+}
+
+// focusReplace shows the replace row and moves the focus to it.
+func (sb *SearchBar) focusReplace() {
+	sb.showReplace = true
+	sb.replace.input.Select(0, len([]rune(sb.replace.input.String())))
+	sb.a.manager.SetFocus(sb.replace)
+}
+
+// replaceField is the input of the replace row. Unlike the find input,
+// it takes the focus itself, so the keys go to the replacement.
+type replaceField struct {
+	sb    *SearchBar
+	input *proxyInput
+}
+
+func (f *replaceField) Size() (int, int) { return f.input.Size() }
+
+func (f *replaceField) Layout(r ui.Rect) *ui.Node {
+	return &ui.Node{
+		Element:  f,
+		Rect:     r,
+		Children: []*ui.Node{f.input.Layout(r)},
+	}
+}
+
+func (f *replaceField) Draw(s ui.Screen, r ui.Rect) {}
+
+func (f *replaceField) HandleKey(ev *tcell.EventKey) bool {
+	if f.sb.a.handleKey(ev) {
+		return true
+	}
+	return f.input.HandleKey(ev)
+}
+
+func (f *replaceField) OnFocus() { f.input.OnFocus() }
+func (f *replaceField) OnBlur()  { f.input.OnBlur() }
+
+// proxyInput delegates focus to its parent element
+type proxyInput struct {
+	*ui.Input
+	parent ui.Element
+}
+
+func (p *proxyInput) Layout(r ui.Rect) *ui.Node {
+	return &ui.Node{Element: p, Rect: r}
+}
+
+func (p *proxyInput) FocusTarget() ui.Element {
+	return p.parent
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestFindAll(t *testing.T) {
+	content := "Hello world\nhello 世界 hello\n\nfoo(bar)\n"
+	tests := []struct {
+		query string
+		regex bool
+		want  []match
+	}{
+		{"hello", false, []match{
+			{Pos{0, 0}, Pos{0, 5}},
+			{Pos{1, 0}, Pos{1, 5}},
+			{Pos{1, 9}, Pos{1, 14}},
+		}},
+		{"(bar)", false, []match{{Pos{3, 3}, Pos{3, 8}}}},
+		{"(bar)", true, []match{{Pos{3, 4}, Pos{3, 7}}}},
+		{`世界\s+h`, true, []match{{Pos{1, 6}, Pos{1, 10}}}},
+		{`world\nhel+o`, true, []match{{Pos{0, 6}, Pos{1, 5}}}},
+		{`^h\w*`, true, []match{{Pos{0, 0}, Pos{0, 5}}, {Pos{1, 0}, Pos{1, 5}}}},
+		{`x*`, true, nil},
+		{"nothing", false, nil},
+	}
+
+	for _, tt := range tests {
+		m, err := findOptions{regex: tt.regex}.compile(tt.query)
+		if err != nil {
+			t.Fatalf("compile(%q): %v", tt.query, err)
+		}
+		if got := m.findAll(content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findAll(%q, regex=%v) = %v, want %v", tt.query, tt.regex, got, tt.want)
+		}
+	}
+}
+
+func TestPatternError(t *testing.T) {
+	_, err := findOptions{regex: true}.compile("a(b")
+	if err == nil {
+		t.Fatal("compile() of an invalid pattern succeeded")
+	}
+	if got, want := patternError(err), "missing closing )"; got != want {
+		t.Errorf("patternError() = %q, want %q", got, want)
+	}
+}
+
+func TestFindOptions(t *testing.T) {
+	content := "Err err error my_err Err2 (err)"
+	tests := []struct {
+		name  string
+		opts  findOptions
+		query string
+		want  int
+	}{
+		{"ignore case", findOptions{}, "err", 6},
+		{"case-sensitive", findOptions{caseSensitive: true}, "Err", 2},
+		{"smart case lower", findOptions{smartCase: true}, "err", 6},
+		{"smart case upper", findOptions{smartCase: true}, "Err", 2},
+		{"whole word", findOptions{wholeWord: true}, "err", 3},
+		{"whole word case-sensitive", findOptions{wholeWord: true, caseSensitive: true}, "err", 2},
+		{"whole word regex", findOptions{wholeWord: true, regex: true}, `err\d?`, 4},
+	}
+
+	for _, tt := range tests {
+		m, err := tt.opts.compile(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := len(m.findAll(content)); got != tt.want {
+			t.Errorf("%s: %d matches, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindWholeWordOverlap(t *testing.T) {
+	// "a a" from column 1 is within "xa", the whole word one overlaps it
+	m, err := findOptions{wholeWord: true}.compile("a a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []match{{Pos{0, 3}, Pos{0, 6}}}
+	if got := m.findAll("xa a a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("findAll() = %v, want %v", got, want)
+	}
+	if got, n := m.replaceAll("xa a a", "b"); got != "xa b" || n != 1 {
+		t.Errorf("replaceAll() = %q, %d, want %q, 1", got, n, "xa b")
+	}
+}
+
+func TestFindNextWith(t *testing.T) {
+	e := newEditor()
+	e.SetText("Err err\nerror err")
+	e.SetSelection(Pos{0, 0}, Pos{0, 3})
+
+	opts := findOptions{wholeWord: true}
+	for _, want := range []Pos{{0, 4}, {1, 6}, {0, 0}} {
+		e.FindNextWith("err", opts)
+		if start, _, _ := e.Selection(); start != want {
+			t.Errorf("FindNextWith() selected from %v, want %v", start, want)
+		}
+	}
+
+	// searched from the cursor, ^ still doesn't match within the line
+	e.SetText("ab ab\nab")
+	e.Pos = Pos{0, 3}
+	e.FindNextWith("^ab", findOptions{regex: true})
+	if start, _, _ := e.Selection(); start != (Pos{1, 0}) {
+		t.Errorf("FindNextWith(^ab) selected from %v, want %v", start, Pos{1, 0})
+	}
+}
+
+func TestMatcherReplaceAll(t *testing.T) {
+	tests := []struct {
+		opts    findOptions
+		query   string
+		repl    string
+		content string
+		want    string
+		wantN   int
+	}{
+		{findOptions{}, "a", "b", "aAa", "bbb", 3},
+		{findOptions{caseSensitive: true}, "a", "$1", "aAa", "$1A$1", 2},
+		{findOptions{regex: true}, `(\w+)=(\w+)`, "$2=$1", "x=1, y=2", "1=x, 2=y", 2},
+		{findOptions{regex: true}, `(?P<k>\w+):`, "${k}_", "a: b:", "a_ b_", 2},
+		{findOptions{wholeWord: true}, "err", "e", "err errs my_err", "e errs my_err", 1},
+		{findOptions{regex: true}, `x*`, "-", "ab", "ab", 0},
+	}
+
+	for _, tt := range tests {
+		m, err := tt.opts.compile(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, n := m.replaceAll(tt.content, tt.repl)
+		if got != tt.want || n != tt.wantN {
+			t.Errorf("replaceAll(%q, %q) = %q, %d, want %q, %d", tt.query, tt.repl, got, n, tt.want, tt.wantN)
+		}
+	}
+}
+
+func TestSearchBarScan(t *testing.T) {
+	app := newApp(ui.NewManager())
+	e := app.newTab("test")
+	e.SetText("foo bar\nbar")
+
+	sb := app.searchBar
+	sb.input.SetText("bar")
+	sb.scan()
+	// next while scanning waits for the results
+	sb.navigate(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for sb.scanning {
+		if time.Now().After(deadline) {
+			t.Fatal("scan not finished")
+		}
+		if !app.manager.RunPosted() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if len(sb.matches) != 2 || sb.activeIndex != 0 {
+		t.Errorf("%d matches, active %d; want 2, the first", len(sb.matches), sb.activeIndex)
+	}
+	if got := e.SelectedText(); got != "bar" {
+		t.Errorf("selected %q, want the first match", got)
+	}
+}
+
+func TestSearchBarReplace(t *testing.T) {
+	app := newApp(ui.NewManager())
+	e := app.newTab("test")
+	e.SetText("x := f(a)\ny := f(b)")
+
+	sb := app.searchBar
+	sb.opts.regex = true
+	sb.input.SetText(`f\((\w)\)`)
+	sb.replace.input.SetText("g($1, $1)")
+	sb.updateMatches()
+
+	// the first press only selects the match
+	sb.replaceOne()
+	if got := e.SelectedText(); got != "f(a)" {
+		t.Fatalf("selected %q, want the first match", got)
+	}
+	sb.replaceOne()
+	if got := string(e.Line(0)); got != "x := g(a, a)" {
+		t.Errorf("after replace line 0 = %q", got)
+	}
+
+	sb.replaceAll()
+	if got := e.String(); got != "x := g(a, a)\ny := g(b, b)\n" {
+		t.Errorf("after replace all text = %q", got)
+	}
+	e.Undo()
+	if got := e.String(); got != "x := g(a, a)\ny := f(b)\n" {
+		t.Errorf("replace all is not a single undo step, text = %q", got)
+	}
+}
+
+func TestSearchBarReplaceInContext(t *testing.T) {
+	app := newApp(ui.NewManager())
+	e := app.newTab("test")
+	e.SetText("x ax")
+
+	// \B only holds within the text, not in the matched "x" alone
+	sb := app.searchBar
+	sb.opts.regex = true
+	sb.input.SetText(`\B(x)`)
+	sb.replace.input.SetText("[$1]")
+	sb.updateMatches()
+	sb.replaceOne()
+	sb.replaceOne()
+	if got := e.String(); got != "x a[x]\n" {
+		t.Errorf("after replace text = %q, want %q", got, "x a[x]\n")
+	}
+}
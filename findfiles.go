@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cansyan/co/ignore"
+	"github.com/cansyan/co/ui"
+)
+
+// Find in Files searches the files under the workspace root
+// and streams the matching lines into a results tab. Like wgrep, the
+// lines can then be edited there and committed back to the files.
+
+const (
+	// maxSearchFileSize skips larger files, they are rarely source code.
+	maxSearchFileSize = 4 << 20
+	// maxSearchResults stops a search after this many matching lines.
+	maxSearchResults = 10_000
+)
+
+var errTooManyResults = errors.New("too many results")
+
+// lineMatch is a line with matches, cols are the matched column ranges.
+type lineMatch struct {
+	line int // 0-based
+	text string
+	cols [][2]int
+}
+
+// fileMatches are the matching lines of one file.
+type fileMatches struct {
+	path  string            // relative to the search root
+	sum   [sha256.Size]byte // of the text searched
+	lines []lineMatch
+}
+
+// walkFiles calls fn with the path, and the path relative to root, of the
+// files under root that git doesn't ignore, skipping large files.
+// It stops when ctx is done, or when fn returns an error.
+func walkFiles(ctx context.Context, root string, fn func(path, rel string) error) error {
+	return walkTree(ctx, root, nil, func(path, rel string, d fs.DirEntry) error {
+		if info, err := d.Info(); err != nil || info.Size() > maxSearchFileSize {
+			return nil
+		}
+		return fn(path, rel)
+	})
+}
+
+// walkTree walks the tree under root, leaving out .git and what git
+// ignores. It calls dir, if not nil, on each directory walked, root
+// included, and fn on each regular file.
+func walkTree(ctx context.Context, root string, dir func(path string, d fs.DirEntry), fn func(path, rel string, d fs.DirEntry) error) error {
+	m := ignore.New(root)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// skip what can't be read
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == root {
+			if dir != nil {
+				dir(path, d)
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || m.Match(rel, true) {
+				return filepath.SkipDir
+			}
+			if dir != nil {
+				dir(path, d)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || m.Match(rel, false) {
+			return nil
+		}
+		return fn(path, rel, d)
+	})
+}
+
+// searchFiles searches the files under root that git doesn't ignore,
+// and calls found with the matches of each file, in walk order. buffers
+// holds the text of open files by absolute path, which is searched instead
+// of what is on disk. It stops when ctx is done, or with errTooManyResults.
+func searchFiles(ctx context.Context, root string, m *matcher, buffers map[string]string, found func(fileMatches)) error {
+	total := 0
+	return walkFiles(ctx, root, func(path, rel string) error {
+		content, ok := buffers[path]
+		if !ok {
+			if content, ok = readText(path); !ok {
+				return nil
+			}
+		}
+		lines := searchText(content, m)
+		if len(lines) == 0 {
+			return nil
+		}
+		if total+len(lines) > maxSearchResults {
+			lines = lines[:maxSearchResults-total]
+		}
+		total += len(lines)
+		found(fileMatches{path: rel, sum: sha256.Sum256([]byte(content)), lines: lines})
+		if total == maxSearchResults {
+			return errTooManyResults
+		}
+		return nil
+	})
+}
+
+// readText returns the content of a text file, false for binary files.
+func readText(path string) (string, bool) {
+	bs, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(bs[:min(len(bs), 8000)], 0) >= 0 {
+		return "", false
+	}
+	return string(bs), true
+}
+
+// searchText returns the matching lines of content.
+func searchText(content string, m *matcher) []lineMatch {
+	matches := m.findAll(content)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	rows := strings.Split(content, "\n")
+	var lines []lineMatch
+	for _, mt := range matches {
+		row := mt.start.Row
+		if n := len(lines); n == 0 || lines[n-1].line != row {
+			lines = append(lines, lineMatch{line: row, text: strings.TrimSuffix(rows[row], "\r")})
+		}
+		lm := &lines[len(lines)-1]
+		// a match spanning lines is shown up to the line end
+		end := utf8.RuneCountInString(lm.text)
+		if mt.end.Row == row {
+			end = min(mt.end.Col, end)
+		}
+		lm.cols = append(lm.cols, [2]int{mt.start.Col, end})
+	}
+	return lines
+}
+
+// fileResult locates a matching line listed in the results tab.
+type fileResult struct {
+	path string // absolute
+	line int    // 0-based
+	col  int    // column of the first match
+	text string // the line when it was searched
+}
+
+// resultKey identifies a result by file and line.
+type resultKey struct {
+	path string
+	line int
+}
+
+// fileSearch is a Find in Files run, its results fill a tab.
+// Once it is done, the result lines can be edited and committed.
+// It is only touched on the UI goroutine.
+type fileSearch struct {
+	query   string
+	root    string
+	results map[resultKey]fileResult
+	paths   map[string]string            // absolute path by the name listed
+	sums    map[string][sha256.Size]byte // of the text of the files when searched, by absolute path
+	decor   []Decoration
+	rows    int // rows of the results when done, until edited
+	files   int
+	lines   int
+	running bool
+	cancel  context.CancelFunc
+}
+
+func newFileSearch(query, root string) *fileSearch {
+	return &fileSearch{
+		query:   query,
+		root:    root,
+		results: make(map[resultKey]fileResult),
+		paths:   make(map[string]string),
+		sums:    make(map[string][sha256.Size]byte),
+		running: true,
+	}
+}
+
+// resultsLabel names the tab that lists the results.
+const resultsLabel = "Find Results"
+
+// resultPrefix formats the line number in front of a result line.
+const resultPrefix = "%5d: "
+
+// add appends the matches of a file to the results buffer e.
+func (s *fileSearch) add(e *Editor, fm fileMatches) {
+	s.files++
+	s.lines += len(fm.lines)
+
+	path := filepath.Join(s.root, fm.path)
+	s.paths[fm.path] = path
+	s.sums[path] = fm.sum
+
+	var sb strings.Builder
+	row := e.Len() // the file name goes after the blank line at the end
+	sb.WriteString("\n" + fm.path + "\n")
+	s.decor = append(s.decor, Decoration{
+		Start: Pos{Row: row},
+		End:   Pos{Row: row, Col: utf8.RuneCountInString(fm.path)},
+		Style: ui.Style{FontBold: true},
+	})
+	for _, lm := range fm.lines {
+		row++
+		prefix := fmt.Sprintf(resultPrefix, lm.line+1)
+		sb.WriteString(prefix + lm.text + "\n")
+		s.results[resultKey{path, lm.line}] = fileResult{
+			path: path,
+			line: lm.line,
+			col:  lm.cols[0][0],
+			text: lm.text,
+		}
+		for _, c := range lm.cols {
+			s.decor = append(s.decor, Decoration{
+				Start: Pos{Row: row, Col: len(prefix) + c[0]},
+				End:   Pos{Row: row, Col: len(prefix) + c[1]},
+				Style: ui.Style{BG: ui.Theme.Highlight},
+			})
+		}
+	}
+	e.Append(sb.String())
+	e.SetDecorations("results", s.decor)
+}
+
+// finish appends a summary once the search has ended with err, and returns it.
+func (s *fileSearch) finish(e *Editor, err error) string {
+	s.running = false
+	summary := fmt.Sprintf("%d matching lines in %d files", s.lines, s.files)
+	switch {
+	case err == nil && s.lines == 0:
+		summary = "No results"
+	case err == nil:
+	case errors.Is(err, errTooManyResults):
+		summary += fmt.Sprintf(" (stopped at %d lines)", maxSearchResults)
+	case errors.Is(err, context.Canceled):
+		summary = "Cancelled, " + summary
+	default:
+		summary = err.Error()
+	}
+	e.Append("\n" + summary + "\n")
+	s.rows = e.Len()
+	e.ReadOnly = false
+	return summary
+}
+
+// resultLine matches the line number in front of a result line.
+var resultLine = regexp.MustCompile(`^ *(\d+): `)
+
+// listed calls fn with the results still listed in lines, the rows of the
+// results buffer, with the text they have now. A result belongs to the
+// closest file name above it, so rows can be added or removed.
+func (s *fileSearch) listed(lines []string, fn func(row int, r fileResult, text string)) {
+	path := ""
+	for row, line := range lines {
+		if p, ok := s.paths[line]; ok {
+			path = p
+			continue
+		}
+		m := resultLine.FindStringSubmatch(line)
+		if m == nil || path == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if r, ok := s.results[resultKey{path, n - 1}]; ok {
+			fn(row, r, line[len(m[0]):])
+		}
+	}
+}
+
+// edited drops the highlights once rows are added or removed,
+// as they would no longer line up.
+func (s *fileSearch) edited(e *Editor) {
+	if !s.running && e.Len() != s.rows {
+		e.SetDecorations("results", nil)
+	}
+}
+
+// findInFiles searches the workspace for query, with the options of
+// the find bar, and streams the results into the results tab.
+// A previous search still running is cancelled.
+func (a *App) findInFiles(query string) {
+	m, err := a.searchBar.opts.compile(query)
+	if err != nil {
+		a.setStatus(patternError(err), 5*time.Second)
+		return
+	}
+	root := a.rootDir()
+	// open files are committed to in their buffer, so that is what is searched
+	buffers := a.openBuffers()
+
+	t := a.listingTab(resultsLabel, func(t *tab) bool { return t.search != nil })
+	if t.search != nil {
+		t.search.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newFileSearch(query, root)
+	s.cancel = cancel
+	t.search = s
+	e := t.editor
+	e.ReadOnly = true
+	e.SetText(fmt.Sprintf("Searching %q in %s\n", query, root))
+	e.Dirty = false
+	e.SetDecorations("results", nil)
+	e.OnChange(func() {
+		a.searchBar.bufferChanged(e)
+		s.edited(e)
+	})
+	a.requestFocus()
+
+	// results of a replaced search are dropped
+	current := func() bool { return t.search == s && s.running }
+	post := func(batch []fileMatches, done func()) {
+		a.manager.Post(func() {
+			if !current() {
+				return
+			}
+			for _, fm := range batch {
+				s.add(e, fm)
+			}
+			if done != nil {
+				done()
+			}
+		})
+	}
+	go func() {
+		// matches are posted in batches, the first one right away
+		var batch []fileMatches
+		var last time.Time
+		err := searchFiles(ctx, root, m, buffers, func(fm fileMatches) {
+			batch = append(batch, fm)
+			if time.Since(last) >= resultsInterval {
+				post(batch, nil)
+				batch, last = nil, time.Now()
+			}
+		})
+		post(batch, func() {
+			a.setStatus(s.finish(e, err), 5*time.Second)
+		})
+	}()
+}
+
+// resultsInterval is how often a search shows the results it found,
+// a redraw for every file would slow down a search with many.
+const resultsInterval = 100 * time.Millisecond
+
+// listingTab activates and returns the first tab that is, or a new
+// read-only tab named label.
+func (a *App) listingTab(label string, is func(t *tab) bool) *tab {
+	for i, t := range a.tabs {
+		if is(t) {
+			a.activeTab = i
+			return t
+		}
+	}
+	a.newTab(label)
+	t := a.tabs[a.activeTab]
+	t.editor.ReadOnly = true
+	t.editor.InlineSuggest = false
+	t.editor.completers = nil
+	return t
+}
+
+// activeSearch returns the search shown in the active tab, if any.
+func (a *App) activeSearch() *fileSearch {
+	if len(a.tabs) == 0 {
+		return nil
+	}
+	return a.tabs[a.activeTab].search
+}
+
+// openResult opens the file of the result at the cursor, at the match.
+func (a *App) openResult() {
+	s := a.activeSearch()
+	if s == nil {
+		return
+	}
+	e := a.getEditor()
+	var r fileResult
+	ok := false
+	lines := strings.Split(e.String(), "\n")
+	s.listed(lines[:e.Pos.Row+1], func(row int, found fileResult, _ string) {
+		r, ok = found, row == e.Pos.Row
+	})
+	if !ok {
+		return
+	}
+	if err := a.openFile(r.path); err != nil {
+		a.setStatus(err.Error(), 5*time.Second)
+		return
+	}
+	e = a.getEditor()
+	e.SetCursor(r.line, r.col)
+	e.CenterRow(r.line)
+	a.recordJump()
+	a.requestFocus()
+}
+
+// cancelFindInFiles stops the search of the active tab,
+// reports whether it was still running.
+func (a *App) cancelFindInFiles() bool {
+	s := a.activeSearch()
+	if s == nil || !s.running {
+		return false
+	}
+	s.cancel()
+	return true
+}
+
+// commitResults writes the result lines edited in the results tab back
+// to their files, at the lines they were found. A file that changed since
+// the search is refused, and reported with the others that failed. Only
+// a sum of the text searched is kept, so the files are read again here.
+func (a *App) commitResults() {
+	s := a.activeSearch()
+	if s == nil || s.running {
+		return
+	}
+	e := a.getEditor()
+	edits := make(map[string]map[int]string) // new text by line, by path
+	s.listed(strings.Split(e.String(), "\n"), func(_ int, r fileResult, text string) {
+		if text == r.text {
+			return
+		}
+		if edits[r.path] == nil {
+			edits[r.path] = make(map[int]string)
+		}
+		edits[r.path][r.line] = text
+	})
+	if len(edits) == 0 {
+		a.setStatus("No changes to commit", 3*time.Second)
+		return
+	}
+
+	var failed []string
+	committed, files := 0, 0
+	for _, path := range slices.Sorted(maps.Keys(edits)) {
+		rel, _ := filepath.Rel(s.root, path)
+		content, ok := a.fileText(path)
+		if !ok || sha256.Sum256([]byte(content)) != s.sums[path] {
+			failed = append(failed, fmt.Sprintf("%s (%v)", rel, errChangedSince))
+			continue
+		}
+		text := setLines(content, edits[path])
+		if _, err := a.replaceFile(path, content, text); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", rel, err))
+			continue
+		}
+		s.sums[path] = sha256.Sum256([]byte(text))
+		for line, t := range edits[path] {
+			k := resultKey{path, line}
+			r := s.results[k]
+			r.text = t
+			s.results[k] = r
+		}
+		committed += len(edits[path])
+		files++
+	}
+
+	msg := fmt.Sprintf("Committed %s in %s", plural(committed, "line"), plural(files, "file"))
+	if len(failed) > 0 {
+		msg += "; refused " + strings.Join(failed, ", ")
+		a.setStatus(msg, 10*time.Second)
+		return
+	}
+	e.Dirty = false
+	a.setStatus(msg, 5*time.Second)
+}
+
+// setLines returns content with the lines in edits replaced,
+// keeping their \r line endings.
+func setLines(content string, edits map[int]string) string {
+	lines := strings.Split(content, "\n")
+	for i, text := range edits {
+		if i >= len(lines) {
+			continue
+		}
+		if strings.HasSuffix(lines[i], "\r") {
+			text += "\r"
+		}
+		lines[i] = text
+	}
+	return strings.Join(lines, "\n")
+}
+
+// promptFindInFiles asks for the query, starting with the selection
+// or the query of the find bar.
+func (a *App) promptFindInFiles() {
+	query := a.searchBar.input.String()
+	if e := a.getEditor(); e != nil {
+		if s := e.SelectedText(); s != "" && !strings.Contains(s, "\n") {
+			query = s
+		}
+	}
+
+	history := a.inputHistory("findInFiles")
+	run := func(text string) {
+		a.manager.CloseOverlay()
+		if text != "" {
+			history.Add(text)
+			a.findInFiles(text)
+		}
+	}
+	input := &ui.Input{OnCommit: run, History: history}
+	input.SetText(query)
+	input.Select(0, utf8.RuneCountInString(query))
+
+	okBtn := &ui.Button{
+		Text:    "Find",
+		OnClick: func() { run(input.String()) },
+		Style:   ui.Style{BG: ui.Theme.Selection},
+	}
+	options := "Options of the find bar: " + a.searchBar.opts.String()
+	dialog := ui.Frame(ui.Border(ui.VStack(
+		ui.PadH(ui.HStack(
+			ui.NewText("Find in files: "),
+			ui.Grow(input),
+		), 1),
+		ui.PadH(ui.NewText(options), 1),
+		ui.PadH(ui.HStack(
+			ui.NewButton("Cancel", a.manager.CloseOverlay),
+			ui.Spacer,
+			okBtn,
+		), 4),
+	).Spacing(1)), 60, 0)
+	a.manager.Overlay(dialog, "top")
+	a.manager.SetFocus(input)
+}
+
+// String lists the enabled options, for display.
+func (o findOptions) String() string {
+	var on []string
+	if o.regex {
+		on = append(on, "regex")
+	}
+	if o.caseSensitive {
+		on = append(on, "case sensitive")
+	}
+	if o.wholeWord {
+		on = append(on, "whole word")
+	}
+	if o.smartCase {
+		on = append(on, "smart case")
+	}
+	if len(on) == 0 {
+		return "none"
+	}
+	return strings.Join(on, ", ")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestSearchFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":     "*.log\nbuild\n",
+		"a.go":           "package a\n\nfunc foo() { foo() }\n",
+		"sub/b.txt":      "no match\nFOO\n",
+		"app.log":        "foo\n",
+		"build/out.go":   "foo\n",
+		".git/config":    "foo\n",
+		"image.bin":      "foo\x00",
+		"sub/empty.text": "",
+	})
+
+	m, err := findOptions{}.compile("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []fileMatches
+	err = searchFiles(context.Background(), root, m, nil, func(fm fileMatches) {
+		fm.sum = [sha256.Size]byte{} // checked by the commit tests
+		got = append(got, fm)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fileMatches{
+		{path: "a.go", lines: []lineMatch{{line: 2, text: "func foo() { foo() }", cols: [][2]int{{5, 8}, {13, 16}}}}},
+		{path: filepath.Join("sub", "b.txt"), lines: []lineMatch{{line: 1, text: "FOO", cols: [][2]int{{0, 3}}}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("searchFiles() = %+v, want %+v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := searchFiles(ctx, root, m, nil, func(fileMatches) {}); err != context.Canceled {
+		t.Errorf("cancelled search = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFileSearchResults(t *testing.T) {
+	a := newApp(ui.NewManager())
+	s := newFileSearch("foo", "/src")
+	e := a.newTab(resultsLabel)
+	e.SetText("Searching\n")
+
+	s.add(e, fileMatches{path: "a.go", lines: []lineMatch{
+		{line: 2, text: "x := foo", cols: [][2]int{{5, 8}}},
+		{line: 10, text: "foo()", cols: [][2]int{{0, 3}}},
+	}})
+	s.finish(e, nil)
+
+	want := "Searching\n\na.go\n    3: x := foo\n   11: foo()\n\n2 matching lines in 1 files\n"
+	if got := e.String(); got != want {
+		t.Errorf("results text = %q, want %q", got, want)
+	}
+	if s.running || e.ReadOnly {
+		t.Error("search still running after finish")
+	}
+
+	// a row added above a result doesn't lose it
+	lines := []string{"Searching", "", "a.go", "added", "    3: x := bar", "   11: foo()"}
+	var got []string
+	s.listed(lines, func(row int, r fileResult, text string) {
+		got = append(got, fmt.Sprintf("%d %s:%d %q", row, r.path, r.line, text))
+	})
+	wantListed := []string{`4 /src/a.go:2 "x := bar"`, `5 /src/a.go:10 "foo()"`}
+	if !reflect.DeepEqual(got, wantListed) {
+		t.Errorf("listed = %q, want %q", got, wantListed)
+	}
+}
+
+func TestFindInFiles(t *testing.T) {
+	root := t.TempDir()
+	files := make(map[string]string)
+	for i := range 30 {
+		files[fmt.Sprintf("f%02d.txt", i)] = "foo\n"
+	}
+	writeFiles(t, root, files)
+
+	a := newApp(ui.NewManager())
+	a.files = &fileIndex{root: root}
+	a.findInFiles("foo")
+	s := a.tabs[a.activeTab].search
+	// the posts of the search run here, as on the UI goroutine
+	deadline := time.Now().Add(5 * time.Second)
+	for s.running {
+		if time.Now().After(deadline) {
+			t.Fatal("search not finished")
+		}
+		if !a.manager.RunPosted() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if s.files != 30 || s.lines != 30 {
+		t.Errorf("found %d lines in %d files, want 30 in 30", s.lines, s.files)
+	}
+	if e := a.getEditor(); e.ReadOnly || !strings.HasSuffix(e.String(), "\n30 matching lines in 30 files\n") {
+		t.Errorf("results read-only %v, text %q; want editable, with the summary", e.ReadOnly, e.String())
+	}
+}
+
+func TestCommitResults(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.txt": "foo\r\nkeep\r\nfoo 2\r\n",
+		"b.txt": "foo\n",
+		"c.txt": "foo", // open, without a newline at the end
+	})
+	m, _ := findOptions{}.compile("foo")
+
+	a := newApp(ui.NewManager())
+	if err := a.openFile(filepath.Join(root, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	a.newTab(resultsLabel)
+	tab := a.tabs[a.activeTab]
+	s := newFileSearch("foo", root)
+	tab.search = s
+	e := tab.editor
+	err := searchFiles(context.Background(), root, m, a.openBuffers(), func(fm fileMatches) { s.add(e, fm) })
+	s.finish(e, err)
+
+	// b.txt changes after the search
+	if err := os.WriteFile(filepath.Join(root, "b.txt"), []byte("foo\nnew\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	text := strings.ReplaceAll(e.String(), "foo 2", "bar 2")
+	text = strings.ReplaceAll(text, "c.txt\n    1: foo", "c.txt\n    1: qux")
+	text = strings.ReplaceAll(text, ": foo\n\n", ": baz\n\n")
+	e.SetText(text)
+	a.commitResults()
+
+	read := func(name string) string {
+		bs, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(bs)
+	}
+	if got, want := read("a.txt"), "foo\r\nkeep\r\nbar 2\r\n"; got != want {
+		t.Errorf("a.txt = %q, want %q", got, want)
+	}
+	if got, want := read("b.txt"), "foo\nnew\n"; got != want {
+		t.Errorf("b.txt = %q, want it refused", got)
+	}
+	// the clean buffer of c.txt is changed, and saved
+	if got, want := read("c.txt"), "qux\n"; got != want {
+		t.Errorf("c.txt = %q, want %q", got, want)
+	}
+	if !strings.Contains(a.status, "refused b.txt") {
+		t.Errorf("status = %q, want b.txt reported", a.status)
+	}
+}
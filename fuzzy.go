@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Scores of fuzzy matching. A matched character scores more at the start
+// of a word, and in a run of matched characters; skipped characters cost.
+const (
+	fuzzyMatchScore  = 16
+	fuzzyPathBonus   = 12 // after a path separator
+	fuzzyWordBonus   = 10 // at the start, or after a space or punctuation
+	fuzzyCamelBonus  = 9  // at a camelCase hump, or a digit after letters
+	fuzzyRunBonus    = 6  // right after the previous matched character
+	fuzzyCaseBonus   = 1  // same case as typed
+	fuzzyGapPenalty  = 1  // per character skipped between matches
+	fuzzyLeadPenalty = 1  // per character before the first match, up to 3
+)
+
+// fuzzyMatch reports whether the characters of pattern appear in s in
+// order, ignoring case. It returns the best score of such a match and the
+// indexes of the matched runes of s.
+func fuzzyMatch(pattern, s string) (score int, positions []int, ok bool) {
+	p := []rune(pattern)
+	t := []rune(s)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	if !fuzzyContains(p, t) {
+		return 0, nil, false
+	}
+
+	// best[i][j] is the best score of matching p[:i+1] with p[i] at t[j],
+	// and from[i][j] where p[i-1] is then.
+	const none = -1 << 30
+	best := make([][]int, len(p))
+	from := make([][]int, len(p))
+	for i := range p {
+		best[i] = make([]int, len(t))
+		from[i] = make([]int, len(t))
+		for j := range best[i] {
+			best[i][j] = none
+		}
+	}
+
+	for i, pr := range p {
+		// the best previous match so far, its score lowered by the gap
+		prev, prevJ := none, -1
+		for j := i; j < len(t); j++ {
+			if i > 0 {
+				if prev != none {
+					prev -= fuzzyGapPenalty
+				}
+				if adj := best[i-1][j-1]; adj != none && adj >= prev {
+					prev, prevJ = adj, j-1
+				}
+			}
+			if unicode.ToLower(t[j]) != unicode.ToLower(pr) {
+				continue
+			}
+
+			v := fuzzyMatchScore + fuzzyBonus(t, j)
+			if t[j] == pr {
+				v += fuzzyCaseBonus
+			}
+			if i == 0 {
+				best[i][j] = v - fuzzyLeadPenalty*min(j, 3)
+				continue
+			}
+			if prev == none {
+				continue
+			}
+			// a run can beat a better match further back
+			if adj := best[i-1][j-1]; adj != none && adj+fuzzyRunBonus > prev {
+				best[i][j], from[i][j] = adj+v+fuzzyRunBonus, j-1
+			} else {
+				best[i][j], from[i][j] = prev+v, prevJ
+			}
+		}
+	}
+
+	last := len(p) - 1
+	end := -1
+	for j, v := range best[last] {
+		if v != none && (end < 0 || v > best[last][end]) {
+			end = j
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	positions = make([]int, len(p))
+	for i, j := last, end; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+	return best[last][end], positions, true
+}
+
+// fuzzyContains reports whether the runes of p appear in t in order,
+// ignoring case. It rules out most candidates before the costly scoring.
+func fuzzyContains(p, t []rune) bool {
+	i := 0
+	for _, r := range t {
+		if i < len(p) && unicode.ToLower(r) == unicode.ToLower(p[i]) {
+			i++
+		}
+	}
+	return i == len(p)
+}
+
+// fuzzyBonus scores where t[j] is: the start of a word or path element,
+// or a camelCase hump.
+func fuzzyBonus(t []rune, j int) int {
+	if j == 0 {
+		return fuzzyWordBonus
+	}
+	prev, cur := t[j-1], t[j]
+	switch {
+	case prev == '/' || prev == '\\':
+		return fuzzyPathBonus
+	case !unicode.IsLetter(prev) && !unicode.IsDigit(prev):
+		return fuzzyWordBonus
+	case unicode.IsLower(prev) && unicode.IsUpper(cur),
+		unicode.IsLetter(prev) && unicode.IsDigit(cur):
+		return fuzzyCamelBonus
+	}
+	return 0
+}
+
+// fuzzyMatchWords matches each space-separated word of query on its own,
+// all of them must match. The scores add up, and the positions are merged.
+func fuzzyMatchWords(query, s string) (score int, positions []int, ok bool) {
+	for _, word := range strings.Fields(query) {
+		n, pos, ok := fuzzyMatch(word, s)
+		if !ok {
+			return 0, nil, false
+		}
+		score += n
+		positions = append(positions, pos...)
+	}
+	slices.Sort(positions)
+	return score, slices.Compact(positions), true
+}
+
+// fuzzyResult is a candidate that matched a query.
+type fuzzyResult[T any] struct {
+	item      T
+	text      string
+	score     int
+	positions []int
+}
+
+// fuzzyFilter returns the items whose text matches query, best first:
+// by score, then shorter text, then in their original order.
+// An empty query keeps all the items in order.
+func fuzzyFilter[T any](query string, items []T, text func(T) string) []fuzzyResult[T] {
+	var results []fuzzyResult[T]
+	for _, item := range items {
+		s := text(item)
+		if score, pos, ok := fuzzyMatchWords(query, s); ok {
+			results = append(results, fuzzyResult[T]{item: item, text: s, score: score, positions: pos})
+		}
+	}
+	if strings.TrimSpace(query) == "" {
+		return results
+	}
+	slices.SortStableFunc(results, func(x, y fuzzyResult[T]) int {
+		if c := cmp.Compare(y.score, x.score); c != 0 {
+			return c
+		}
+		return cmp.Compare(len(x.text), len(y.text))
+	})
+	return results
+}
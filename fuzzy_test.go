@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		ok         bool
+		positions  []int
+	}{
+		{"", "main.go", true, nil},
+		{"mg", "main.go", true, []int{0, 5}},
+		{"MAIN", "main.go", true, []int{0, 1, 2, 3}},
+		{"gm", "main.go", false, nil},
+		{"toolong", "short", false, nil},
+		// the start of a path element beats an earlier match
+		{"f", "ui/buffer/find.go", true, []int{10}},
+		{"fg", "ui/buffer/find.go", true, []int{10, 15}},
+		// a camelCase hump beats an earlier match
+		{"of", "App.openFile", true, []int{4, 8}},
+		// a run beats scattered matches
+		{"ab", "axb_ab", true, []int{4, 5}},
+		{"中文", "ui/中文.go", true, []int{3, 4}},
+	}
+	for _, tt := range tests {
+		_, pos, ok := fuzzyMatch(tt.pattern, tt.s)
+		if ok != tt.ok || !reflect.DeepEqual(pos, tt.positions) {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, %v, want %v, %v", tt.pattern, tt.s, pos, ok, tt.positions, tt.ok)
+		}
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	items := []string{"readme.md", "ui/component.go", "main.go", "main_test.go", "editor.go"}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", items},
+		{"main", []string{"main.go", "main_test.go"}},
+		{"mt", []string{"main_test.go", "ui/component.go"}},
+		{"ed go", []string{"editor.go"}},
+		{"co", []string{"ui/component.go"}},
+		{"xyz", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range fuzzyFilter(tt.query, items, func(s string) string { return s }) {
+			got = append(got, r.item)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("fuzzyFilter(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/cansyan/co/ui"
+)
+
+// helpEntry is a line of the keyboard shortcut cheat sheet.
+type helpEntry struct {
+	name string // "Category: Title"
+	keys []string
+	id   string // of the command
+}
+
+// helpEntries builds the cheat sheet from the live keymap and the
+// commands, so it always reflects what the keys actually do.
+func (a *App) helpEntries() []helpEntry {
+	keys := a.boundKeys()
+	var entries []helpEntry
+	for _, c := range a.commands.list() {
+		entries = append(entries, helpEntry{name: c.Name(), keys: keys[c.ID], id: c.ID})
+	}
+
+	slices.SortFunc(entries, func(x, y helpEntry) int {
+		return strings.Compare(x.name, y.name)
+	})
+	return entries
+}
+
+// boundKeys returns the keys that currently trigger each command,
+// leaving out bindings overridden by later or more specific ones.
+func (a *App) boundKeys() map[string][]string {
+	keys := make(map[string][]string)
+	for _, b := range a.keymap {
+		if b.Command == "" {
+			continue
+		}
+		ctx := make(map[string]bool)
+		for _, t := range whenTerms(b.When) {
+			if !strings.HasPrefix(t, "!") {
+				ctx[t] = true
+			}
+		}
+		if a.keymap.lookup(b.Key, ctx) != b.Command {
+			continue
+		}
+		if !slices.Contains(keys[b.Command], b.Key) {
+			keys[b.Command] = append(keys[b.Command], b.Key)
+		}
+	}
+	return keys
+}
+
+// actionTitle turns a command ID like "edit.selectWord"
+// into a name like "Edit: Select Word".
+func actionTitle(name string) string {
+	category, title, ok := strings.Cut(name, ".")
+	if !ok {
+		return capitalize(name)
+	}
+
+	var sb strings.Builder
+	for i, r := range title {
+		if i > 0 && unicode.IsUpper(r) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteRune(r)
+	}
+	return capitalize(category) + ": " + capitalize(sb.String())
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	rs := []rune(s)
+	rs[0] = unicode.ToUpper(rs[0])
+	return string(rs)
+}
+
+func (a *App) fillHelpMode(p *Palette, query string) {
+	words := strings.Fields(strings.ToLower(query))
+	for _, entry := range a.helpEntries() {
+		text := strings.ToLower(entry.name + " " + strings.Join(entry.keys, " "))
+		ok := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			p.list.Append(ui.ListItem{
+				Name:   entry.name,
+				Detail: strings.Join(entry.keys, ", "),
+				Value:  entry.id,
+			})
+		}
+	}
+
+	p.list.OnSelect = func(item ui.ListItem) {
+		// close the palette first, so the action runs where it was invoked
+		a.requestFocus()
+		a.commands.run(item.Value.(string))
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestActionTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"edit.undo", "Edit: Undo"},
+		{"edit.selectWord", "Edit: Select Word"},
+		{"cursor.lineStart", "Cursor: Line Start"},
+		{"quit", "Quit"},
+	}
+
+	for _, tt := range tests {
+		if got := actionTitle(tt.name); got != tt.want {
+			t.Errorf("actionTitle(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBoundKeys(t *testing.T) {
+	app := newApp(ui.NewManager())
+	km, _ := buildKeymap([]keyBinding{
+		{Key: "ctrl+s"},
+		{Key: "f2", Command: "file.save"},
+	}, app.commands)
+	app.setKeymap(km)
+	keys := app.boundKeys()
+
+	tests := []struct {
+		action string
+		want   []string
+	}{
+		{"file.save", []string{"f2"}},
+		{"palette.commands", []string{"ctrl+p", "ctrl+k ctrl+p"}},
+		{"palette.prev", []string{"up", "ctrl+p"}},
+		{"app.quit", nil},
+	}
+	for _, tt := range tests {
+		if got := keys[tt.action]; !slices.Equal(got, tt.want) {
+			t.Errorf("boundKeys()[%q] = %q, want %q", tt.action, got, tt.want)
+		}
+	}
+}
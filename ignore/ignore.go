@@ -0,0 +1,268 @@
+// Package ignore tells which files git ignores, from the .gitignore files
+// of a tree, .git/info/exclude and the global excludes file, following
+// the rules of gitignore(5).
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// pattern is a line of an ignore file.
+type pattern struct {
+	segments []string // split at slashes, "**" matches any number of them
+	base     string   // directory of the file, relative to the top, "" at the top
+	negate   bool
+	dirOnly  bool
+}
+
+// parse parses a line of the ignore file in base, ok is false for blank
+// lines and comments.
+func parse(line, base string) (p pattern, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+
+	// a slash at the start or in the middle anchors the pattern to base,
+	// otherwise it matches at any level below
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	p.segments = strings.Split(line, "/")
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	p.base = base
+	return p, true
+}
+
+// trimTrailingSpace removes trailing spaces, except one escaped with a backslash.
+func trimTrailingSpace(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// match reports whether the pattern matches rel, a slash-separated path
+// relative to the top. It doesn't look at the directories above rel.
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments, where "**" stands for any number
+// of them; but a trailing "**" only for one or more, as "abc/**" matches
+// what is inside abc, not abc itself.
+func matchSegments(pats, names []string) bool {
+	for len(pats) > 0 {
+		if pats[0] == "**" {
+			if len(pats) == 1 {
+				return len(names) > 0
+			}
+			for i := range len(names) + 1 {
+				if matchSegments(pats[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pats[0], names[0]); err != nil || !ok {
+			return false
+		}
+		pats, names = pats[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// Matcher matches paths of a tree against its ignore files. The .gitignore
+// files are read as they are needed, and kept, so a Matcher sees the tree
+// as it was; make a new one to see changes. It is safe for concurrent use.
+type Matcher struct {
+	top    string // the top of the repository, or the root when not in one
+	prefix string // of paths relative to the root to make them relative to top
+
+	base []pattern // .git/info/exclude, then the global excludes file
+
+	mu   sync.Mutex
+	dirs map[string][]pattern // .gitignore patterns by directory relative to top
+}
+
+// New returns the matcher of the tree at root. When root is inside a git
+// repository, the .gitignore files above it up to the top apply too.
+func New(root string) *Matcher {
+	m := &Matcher{top: root, dirs: make(map[string][]pattern)}
+	for dir := root; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			m.top = dir
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	if rel, err := filepath.Rel(m.top, root); err == nil && rel != "." {
+		m.prefix = filepath.ToSlash(rel) + "/"
+	}
+
+	// the global file has the lowest precedence, so it comes first
+	if file := GlobalExcludesFile(); file != "" {
+		m.base = append(m.base, readPatterns(file, "")...)
+	}
+	m.base = append(m.base, readPatterns(filepath.Join(m.top, ".git", "info", "exclude"), "")...)
+	return m
+}
+
+// readPatterns reads the patterns of the ignore file at path, if it exists.
+func readPatterns(file, base string) []pattern {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var ps []pattern
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if p, ok := parse(sc.Text(), base); ok {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// gitignore returns the patterns of the .gitignore in dir, relative to top.
+func (m *Matcher) gitignore(dir string) []pattern {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ps, ok := m.dirs[dir]
+	if !ok {
+		ps = readPatterns(filepath.Join(m.top, filepath.FromSlash(dir), ".gitignore"), dir)
+		m.dirs[dir] = ps
+	}
+	return ps
+}
+
+// Match reports whether the path rel, relative to the root, is ignored by
+// a pattern. It doesn't look at the directories above rel, which a walk
+// has already checked, see Ignored.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	rel = m.prefix + filepath.ToSlash(rel)
+	ignored := false
+	check := func(ps []pattern) {
+		// the last pattern that matches decides
+		for _, p := range ps {
+			if p.match(rel, isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	check(m.base)
+	// a deeper .gitignore has precedence
+	check(m.gitignore(""))
+	for i, c := range rel {
+		if c == '/' {
+			check(m.gitignore(rel[:i]))
+		}
+	}
+	return ignored
+}
+
+// Ignored reports whether the path rel, relative to the root, is ignored,
+// by itself or by being in an ignored directory. Files in an ignored
+// directory can't be included again.
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	for i, c := range rel {
+		if c == '/' && m.Match(rel[:i], true) {
+			return true
+		}
+	}
+	return m.Match(rel, isDir)
+}
+
+// GlobalExcludesFile returns the path of the global excludes file: the
+// core.excludesFile of the user's git config, or git's default.
+func GlobalExcludesFile() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	home, _ := os.UserHomeDir()
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	// like git, ~/.gitconfig wins over the XDG config
+	var configs []string
+	if home != "" {
+		configs = append(configs, filepath.Join(home, ".gitconfig"))
+	}
+	if configHome != "" {
+		configs = append(configs, filepath.Join(configHome, "git", "config"))
+	}
+	for _, config := range configs {
+		if file := excludesFileSetting(config); file != "" {
+			if rest, ok := strings.CutPrefix(file, "~/"); ok && home != "" {
+				file = filepath.Join(home, rest)
+			}
+			return file
+		}
+	}
+	if configHome == "" {
+		return ""
+	}
+	return filepath.Join(configHome, "git", "ignore")
+}
+
+// excludesFileSetting returns core.excludesFile from the git config file
+// at path. Only the plain form of the setting is understood.
+func excludesFileSetting(config string) string {
+	f, err := os.Open(config)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	section := ""
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] \t"))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != "core" || !strings.EqualFold(strings.TrimSpace(key), "excludesfile") {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return ""
+}
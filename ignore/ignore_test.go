@@ -0,0 +1,167 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The examples of gitignore(5).
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"hello.*", "hello.txt", false, true},
+		{"hello.*", "a/hello.java", false, true},
+		{"hello.*", "hello", false, false},
+
+		// a trailing slash matches directories only
+		{"frotz/", "frotz", true, true},
+		{"frotz/", "a/frotz", true, true},
+		{"frotz/", "frotz", false, false},
+		{"doc/frotz/", "doc/frotz", true, true},
+		{"doc/frotz/", "a/doc/frotz", true, false},
+		{"doc/frotz", "doc/frotz", false, true},
+
+		// a slash at the start or in the middle anchors
+		{"/bar", "bar", false, true},
+		{"/bar", "a/bar", false, false},
+		{"bar", "a/bar", true, true},
+		{"Documentation/*.html", "Documentation/git.html", false, true},
+		{"Documentation/*.html", "Documentation/ppc/ppc.html", false, false},
+		{"Documentation/*.html", "tools/perf/Documentation/perf.html", false, false},
+
+		// "*" doesn't match a slash
+		{"foo/*", "foo/test.json", false, true},
+		{"foo/*", "foo/bar", true, true},
+		{"foo/*", "foo/bar/hello.c", false, false},
+		{"foo/?", "foo/a", false, true},
+		{"foo/[a-c]", "foo/b", false, true},
+		{"foo/[a-c]", "foo/d", false, false},
+
+		// double stars
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", true, true},
+		{"**/foo/bar", "foo/bar", false, true},
+		{"**/foo/bar", "a/foo/bar", false, true},
+		{"**/foo/bar", "a/foo/x/bar", false, false},
+		{"abc/**", "abc/x", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/x/c", false, false},
+		{"x**y", "xay", false, true}, // other stars are plain
+		{"x**y", "xa/y", false, false},
+
+		// escapes and spaces
+		{`\#file`, "#file", false, true},
+		{`\!important`, "!important", false, true},
+		{"trailing  ", "trailing", false, true},
+		{`space\ `, "space ", false, true},
+	}
+	for _, tt := range tests {
+		p, ok := parse(tt.pattern, "")
+		if !ok {
+			t.Errorf("parse(%q) not ok", tt.pattern)
+			continue
+		}
+		if got := p.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%q matches %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestParseSkips(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/", "!", "\r"} {
+		if _, ok := parse(line, ""); ok {
+			t.Errorf("parse(%q) ok, want skipped", line)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	repo := t.TempDir()
+	writeFiles(t, repo, map[string]string{
+		".git/info/exclude": "*.orig\n",
+		".gitignore":        "*.log\nbuild/\n!build/keep.txt\n/*.tmp\n",
+		"sub/.gitignore":    "*.tmp\n!debug.log\n",
+		// everything in only/ but only/bar
+		"only/.gitignore": "/*\n!/bar\n/bar/*\n!/bar/baz\n",
+	})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"main.go", false, false},
+		{"app.log", false, true},
+		{"sub/app.log", false, true},
+		{"sub/debug.log", false, false}, // a deeper file has precedence
+		{"x.tmp", false, true},
+		{"sub/x.tmp", false, true},
+		{"other/x.tmp", false, false},
+		{"a.orig", false, true}, // .git/info/exclude
+		{"build", true, true},
+		{"build", false, false},
+		{"build/keep.txt", false, true}, // in an ignored directory
+		{"only/foo", false, true},
+		{"only/bar", true, false},
+		{"only/bar/baz", false, false},
+		{"only/bar/qux", false, true},
+	}
+	m := New(repo)
+	for _, tt := range tests {
+		if got := m.Ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	// below the top of the repository, its .gitignore files still apply
+	m = New(filepath.Join(repo, "sub"))
+	if !m.Ignored("app.log", false) || m.Ignored("debug.log", false) {
+		t.Error("a matcher below the top doesn't follow the .gitignore files above")
+	}
+}
+
+func TestGlobalExcludesFile(t *testing.T) {
+	home := t.TempDir()
+	config := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	if got, want := GlobalExcludesFile(), filepath.Join(config, "git", "ignore"); got != want {
+		t.Errorf("GlobalExcludesFile() = %q, want the default %q", got, want)
+	}
+
+	writeFiles(t, home, map[string]string{
+		".gitconfig":        "[user]\n\tname = x\n[core]\n\texcludesFile = ~/.gitignore_global\n",
+		".gitignore_global": "*.swp\n",
+	})
+	if got, want := GlobalExcludesFile(), filepath.Join(home, ".gitignore_global"); got != want {
+		t.Errorf("GlobalExcludesFile() = %q, want %q", got, want)
+	}
+	if m := New(t.TempDir()); !m.Ignored("a/b.swp", false) {
+		t.Error("the global excludes file is not followed")
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cansyan/co/ui"
+)
+
+// keyBinding binds a key, or a chord of space-separated keys, to a command by ID.
+// When limits the binding to a context, e.g. "editorFocus" or
+// "searchOpen && !editorFocus"; an empty When applies everywhere.
+type keyBinding struct {
+	Key     string `json:"key"`
+	Command string `json:"command"` // empty to unbind the key
+	When    string `json:"when,omitempty"`
+}
+
+// keyContexts are the names a When clause can test.
+var keyContexts = []string{
+	"editorFocus",    // the editor has keyboard focus
+	"completionOpen", // the completion popup is showing
+	"snippetActive",  // a snippet's tab stops are being filled in
+	"paletteOpen",    // the command palette is open
+	"searchOpen",     // the find bar is visible
+	"searchFocus",    // the find bar has keyboard focus
+	"replaceFocus",   // the replacement input has keyboard focus
+	"resultsFocus",   // the editor of the Find in Files results has keyboard focus
+	"previewFocus",   // the editor of the Replace in Files preview has keyboard focus
+	"explorerFocus",  // the file explorer has keyboard focus
+}
+
+// defaultKeymap holds the bindings beyond the default key of each command:
+// those limited to a context, and other keys for the same command.
+var defaultKeymap = []keyBinding{
+	{Key: "ctrl+k ctrl+p", Command: "palette.commands"},
+
+	{Key: "up", Command: "cursor.up", When: "editorFocus"},
+	{Key: "down", Command: "cursor.down", When: "editorFocus"},
+	{Key: "left", Command: "cursor.left", When: "editorFocus"},
+	{Key: "right", Command: "cursor.right", When: "editorFocus"},
+	{Key: "home", Command: "cursor.lineStart", When: "editorFocus"},
+	{Key: "ctrl+a", Command: "cursor.lineStart", When: "editorFocus"},
+	{Key: "alt+left", Command: "cursor.lineStart", When: "editorFocus"},
+	{Key: "end", Command: "cursor.lineEnd", When: "editorFocus"},
+	{Key: "ctrl+e", Command: "cursor.lineEnd", When: "editorFocus"},
+	{Key: "alt+right", Command: "cursor.lineEnd", When: "editorFocus"},
+	{Key: "alt+up", Command: "goto.firstLine", When: "editorFocus"},
+	{Key: "alt+down", Command: "goto.lastLine", When: "editorFocus"},
+	{Key: "ctrl+g", Command: "goto.definition", When: "editorFocus"},
+
+	{Key: "enter", Command: "edit.newline", When: "editorFocus"},
+	{Key: "backspace", Command: "edit.deleteLeft", When: "editorFocus"},
+	{Key: "backspace2", Command: "edit.deleteLeft", When: "editorFocus"},
+	{Key: "tab", Command: "edit.tab", When: "editorFocus"},
+	{Key: "esc", Command: "edit.cancel", When: "editorFocus"},
+	{Key: "ctrl+z", Command: "edit.undo", When: "editorFocus"},
+	{Key: "ctrl+y", Command: "edit.redo", When: "editorFocus"},
+	{Key: "ctrl+c", Command: "edit.copy", When: "editorFocus"},
+	{Key: "ctrl+x", Command: "edit.cut", When: "editorFocus"},
+	{Key: "ctrl+v", Command: "edit.paste", When: "editorFocus"},
+	{Key: "ctrl+d", Command: "edit.selectWord", When: "editorFocus"},
+	{Key: "ctrl+l", Command: "edit.selectLine", When: "editorFocus"},
+	{Key: "ctrl+b", Command: "edit.selectBrackets", When: "editorFocus"},
+	{Key: "ctrl+k ctrl+u", Command: "edit.upperCase", When: "editorFocus"},
+	{Key: "ctrl+k ctrl+l", Command: "edit.lowerCase", When: "editorFocus"},
+
+	{Key: "tab", Command: "snippet.next", When: "editorFocus && snippetActive"},
+	{Key: "backtab", Command: "snippet.prev", When: "editorFocus && snippetActive"},
+	{Key: "esc", Command: "snippet.exit", When: "editorFocus && snippetActive"},
+
+	{Key: "ctrl+space", Command: "completion.show", When: "editorFocus"},
+	{Key: "down", Command: "completion.next", When: "editorFocus && completionOpen"},
+	{Key: "ctrl+n", Command: "completion.next", When: "editorFocus && completionOpen"},
+	{Key: "up", Command: "completion.prev", When: "editorFocus && completionOpen"},
+	{Key: "ctrl+p", Command: "completion.prev", When: "editorFocus && completionOpen"},
+	{Key: "enter", Command: "completion.accept", When: "editorFocus && completionOpen"},
+	{Key: "tab", Command: "completion.accept", When: "editorFocus && completionOpen"},
+	{Key: "esc", Command: "completion.close", When: "editorFocus && completionOpen"},
+
+	{Key: "enter", Command: "results.open", When: "editorFocus && resultsFocus"},
+	{Key: "esc", Command: "results.cancel", When: "editorFocus && resultsFocus"},
+	{Key: "space", Command: "replace.toggle", When: "editorFocus && previewFocus"},
+	{Key: "enter", Command: "replace.open", When: "editorFocus && previewFocus"},
+	{Key: "alt+enter", Command: "replace.apply", When: "editorFocus && previewFocus"},
+	{Key: "esc", Command: "replace.cancel", When: "editorFocus && previewFocus"},
+
+	{Key: "esc", Command: "explorer.focus", When: "explorerFocus"},
+	{Key: "a", Command: "explorer.newFile", When: "explorerFocus"},
+	{Key: "A", Command: "explorer.newFolder", When: "explorerFocus"},
+	{Key: "r", Command: "explorer.rename", When: "explorerFocus"},
+	{Key: "f2", Command: "explorer.rename", When: "explorerFocus"},
+	{Key: "delete", Command: "explorer.delete", When: "explorerFocus"},
+
+	{Key: "down", Command: "palette.next", When: "paletteOpen"},
+	{Key: "ctrl+n", Command: "palette.next", When: "paletteOpen"},
+	{Key: "up", Command: "palette.prev", When: "paletteOpen"},
+	{Key: "ctrl+p", Command: "palette.prev", When: "paletteOpen"},
+	{Key: "enter", Command: "palette.accept", When: "paletteOpen"},
+
+	{Key: "enter", Command: "find.next", When: "searchFocus"},
+	{Key: "down", Command: "find.newer", When: "searchFocus"},
+	{Key: "ctrl+n", Command: "find.newer", When: "searchFocus"},
+	{Key: "up", Command: "find.older", When: "searchFocus"},
+	{Key: "ctrl+p", Command: "find.older", When: "searchFocus"},
+	{Key: "esc", Command: "find.close", When: "searchFocus"},
+	{Key: "tab", Command: "find.focusReplace", When: "searchFocus"},
+	{Key: "alt+r", Command: "find.toggleRegex", When: "searchOpen"},
+	{Key: "alt+c", Command: "find.toggleCase", When: "searchOpen"},
+	{Key: "alt+w", Command: "find.toggleWholeWord", When: "searchOpen"},
+
+	{Key: "enter", Command: "find.replaceOne", When: "replaceFocus"},
+	{Key: "alt+enter", Command: "find.replaceAll", When: "replaceFocus"},
+	{Key: "tab", Command: "find.focusFind", When: "replaceFocus"},
+	{Key: "backtab", Command: "find.focusFind", When: "replaceFocus"},
+	{Key: "esc", Command: "find.close", When: "replaceFocus"},
+}
+
+// keymap is an ordered list of normalized key bindings.
+type keymap []keyBinding
+
+// buildKeymap merges user bindings over the defaults, the keys of the
+// commands then defaultKeymap. Invalid bindings are skipped, and reported
+// together with conflicting ones.
+func buildKeymap(user []keyBinding, commands *commandRegistry) (keymap, []error) {
+	var errs []error
+	defaults := append(commands.defaultBindings(), defaultKeymap...)
+	km := make(keymap, 0, len(defaults)+len(user))
+	for _, bindings := range [][]keyBinding{defaults, user} {
+		seen := make(map[string]string) // key and context -> command
+		for _, b := range bindings {
+			nb, err := normalizeBinding(b, commands)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			id := nb.Key + " when " + nb.When
+			if cmd, ok := seen[id]; ok && cmd != nb.Command {
+				errs = append(errs, fmt.Errorf("keymap: %q is bound to both %q and %q", id, cmd, nb.Command))
+				continue
+			}
+			seen[id] = nb.Command
+			km = append(km, nb)
+		}
+	}
+	return km, append(errs, chordConflicts(km)...)
+}
+
+// chordConflicts reports keys bound on their own that also start a chord,
+// they are unreachable because the chord takes the key first.
+func chordConflicts(km keymap) []error {
+	var errs []error
+	for _, b := range km {
+		if b.Command == "" {
+			continue
+		}
+		for _, c := range km {
+			if c.Command != "" && strings.HasPrefix(c.Key, b.Key+" ") {
+				errs = append(errs, fmt.Errorf("keymap: %q is shadowed by chord %q", b.Key, c.Key))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func normalizeBinding(b keyBinding, commands *commandRegistry) (keyBinding, error) {
+	key, err := ui.ParseKey(b.Key)
+	if err != nil {
+		return b, fmt.Errorf("keymap: %w", err)
+	}
+	if _, ok := commands.lookup(b.Command); b.Command != "" && !ok {
+		return b, fmt.Errorf("keymap: %q: unknown command %q", b.Key, b.Command)
+	}
+
+	terms := whenTerms(b.When)
+	for _, t := range terms {
+		if !slices.Contains(keyContexts, strings.TrimPrefix(t, "!")) {
+			return b, fmt.Errorf("keymap: %q: unknown context %q", b.Key, t)
+		}
+	}
+	// sort terms so equivalent clauses compare equal
+	slices.Sort(terms)
+	return keyBinding{Key: key, Command: b.Command, When: strings.Join(terms, " && ")}, nil
+}
+
+func whenTerms(when string) []string {
+	var terms []string
+	for _, t := range strings.Split(when, "&&") {
+		if t = strings.TrimSpace(t); t != "" {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// lookup returns the command bound to key in the given context.
+// The binding with the most specific When clause wins,
+// later bindings override earlier ones of equal specificity.
+func (km keymap) lookup(key string, ctx map[string]bool) string {
+	command, best := "", -1
+	for _, b := range km {
+		if b.Key != key {
+			continue
+		}
+		terms := whenTerms(b.When)
+		if len(terms) < best || !matchWhen(terms, ctx) {
+			continue
+		}
+		command, best = b.Command, len(terms)
+	}
+	return command
+}
+
+func matchWhen(terms []string, ctx map[string]bool) bool {
+	for _, t := range terms {
+		name, negate := strings.CutPrefix(t, "!")
+		if ctx[name] == negate {
+			return false
+		}
+	}
+	return true
+}
+
+// keymapPath returns the location of the user keymap file.
+func keymapPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "co", "keymap.json"), nil
+}
+
+// loadKeymapFile reads user bindings, a missing file is not an error.
+func loadKeymapFile(path string) ([]keyBinding, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var bindings []keyBinding
+	if err := json.Unmarshal(bs, &bindings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bindings, nil
+}
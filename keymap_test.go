@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestDefaultKeymap(t *testing.T) {
+	app := newApp(ui.NewManager())
+	_, errs := buildKeymap(nil, app.commands)
+	for _, err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestBuildKeymap(t *testing.T) {
+	app := newApp(ui.NewManager())
+	tests := []struct {
+		name     string
+		user     []keyBinding
+		wantErrs int
+	}{
+		{"empty", nil, 0},
+		{"valid", []keyBinding{{Key: "Ctrl+Shift+D", Command: "edit.undo", When: "editorFocus"}}, 0},
+		{"unbind", []keyBinding{{Key: "ctrl+d"}}, 0},
+		{"unknown command", []keyBinding{{Key: "ctrl+d", Command: "nope"}}, 1},
+		{"unknown key", []keyBinding{{Key: "ctrl+nope", Command: "edit.undo"}}, 1},
+		{"unknown modifier", []keyBinding{{Key: "hyper+d", Command: "edit.undo"}}, 1},
+		{"unknown context", []keyBinding{{Key: "ctrl+d", Command: "edit.undo", When: "nope"}}, 1},
+		{"conflict", []keyBinding{
+			{Key: "ctrl+d", Command: "edit.undo", When: "editorFocus && searchOpen"},
+			{Key: "Ctrl+D", Command: "edit.redo", When: "searchOpen && editorFocus"},
+		}, 1},
+		{"chord", []keyBinding{{Key: "ctrl+k  U", Command: "edit.undo"}}, 0},
+		{"shadowed by chord", []keyBinding{{Key: "ctrl+k", Command: "edit.undo"}}, 1},
+		{"same command twice", []keyBinding{
+			{Key: "ctrl+d", Command: "edit.undo"},
+			{Key: "ctrl+d", Command: "edit.undo"},
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := buildKeymap(tt.user, app.commands)
+			if len(errs) != tt.wantErrs {
+				t.Errorf("buildKeymap() errors = %d, want %d: %v", len(errs), tt.wantErrs, errs)
+			}
+		})
+	}
+}
+
+func TestKeymapLookup(t *testing.T) {
+	km := keymap{
+		{Key: "ctrl+p", Command: "palette"},
+		{Key: "ctrl+p", Command: "prev", When: "paletteOpen"},
+		{Key: "ctrl+p", Command: "find", When: "searchFocus"},
+		{Key: "ctrl+p", Command: "notEditor", When: "!editorFocus && searchOpen"},
+		{Key: "ctrl+d", Command: "select", When: "editorFocus"},
+		{Key: "ctrl+d", Command: "override", When: "editorFocus"},
+		{Key: "ctrl+u", Command: "upper"},
+		{Key: "ctrl+u", Command: ""},
+	}
+	tests := []struct {
+		key  string
+		ctx  map[string]bool
+		want string
+	}{
+		{"ctrl+p", nil, "palette"},
+		{"ctrl+p", map[string]bool{"paletteOpen": true}, "prev"},
+		{"ctrl+p", map[string]bool{"searchFocus": true}, "find"},
+		{"ctrl+p", map[string]bool{"searchOpen": true}, "notEditor"},
+		{"ctrl+p", map[string]bool{"searchOpen": true, "editorFocus": true}, "palette"},
+		{"ctrl+d", map[string]bool{"editorFocus": true}, "override"},
+		{"ctrl+d", nil, ""},
+		{"ctrl+u", nil, ""},
+		{"ctrl+x", nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := km.lookup(tt.key, tt.ctx); got != tt.want {
+			t.Errorf("lookup(%q, %v) = %q, want %q", tt.key, tt.ctx, got, tt.want)
+		}
+	}
+}
+
+func TestChordEnabled(t *testing.T) {
+	a := newApp(ui.NewManager())
+	enabled := a.manager.ChordEnabled
+	// nothing is focused, so the chords of the editor don't apply
+	if enabled("ctrl+k ctrl+u") {
+		t.Error("editor chord enabled without editor focus")
+	}
+	if !enabled("ctrl+k ctrl+p") {
+		t.Error("global chord not enabled")
+	}
+
+	km, _ := buildKeymap([]keyBinding{{Key: "ctrl+k ctrl+p"}}, a.commands)
+	a.setKeymap(km)
+	if enabled("ctrl+k ctrl+p") {
+		t.Error("unbound chord still enabled")
+	}
+}
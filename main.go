@@ -19,14 +19,17 @@ import (
 	"syscall"
 	"time"
 	"unicode"
-	"unicode/utf8"
 
 	"github.com/cansyan/co/ui"
 	"github.com/gdamore/tcell/v2"
 	"github.com/mattn/go-runewidth"
 )
 
-var verbose = flag.Bool("v", false, "enable verbose logging")
+var (
+	verbose   = flag.Bool("v", false, "enable verbose logging")
+	noSession = flag.Bool("no-session", false, "start without restoring the last session of the directory")
+	follow    = flag.Bool("follow", false, "with -, keep appending the standard input as it comes, like tail -f")
+)
 
 func main() {
 	flag.Parse()
@@ -61,36 +64,160 @@ func main() {
 	}()
 
 	app := newApp(manager)
-	if arg := flag.Arg(0); arg != "" {
-		path, line := parseFileArg(arg)
-		err := app.openFile(path)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		if line > 0 {
-			if e := app.getEditor(); e != nil {
-				e.gotoLine(line - 1)
+	app.loadKeymap()
+	app.loadHistory()
+	defer app.saveHistory()
+	app.loadRecent()
+	defer app.saveRecent()
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	root, err := app.openArgs(flag.Args(), os.Stdin, *follow)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if root != "" {
+		dir = root
+	}
+	// without a file, restore the session of the directory, and save it on
+	// exit; files opened for a while, or a pipe, leave it alone
+	session := len(app.tabs) == 0
+	if session {
+		restored := false
+		if !*noSession {
+			restored, err = app.restoreSession(dir)
+			if err != nil {
+				log.Print(err)
 			}
 		}
-	} else {
-		app.newTab("untitled")
+		if !restored {
+			app.newTab("untitled")
+		}
 	}
 	app.requestFocus()
+	app.indexFiles(dir)
+	app.indexSymbols(dir)
+	if root != "" {
+		app.showPalette("")
+	}
 
 	if err := manager.Start(app); err != nil {
 		log.Print(err)
 		return
 	}
+	if !session {
+		return
+	}
+	if err := app.saveSession(dir); err != nil {
+		log.Print(err)
+	}
 }
 
-func parseFileArg(arg string) (path string, line int) {
+// openArgs opens the files of the command line arguments, each in its own
+// tab: a file, at the line and column if given, every file a glob pattern
+// matches, or stdin for "-". It returns the directory of an argument
+// naming one, to become the root of the workspace.
+func (a *App) openArgs(args []string, stdin io.Reader, follow bool) (root string, err error) {
+	for _, arg := range args {
+		if arg == "-" {
+			if err := a.openReader(stdin, follow); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", arg, err)
+			}
+			opened := 0
+			for _, path := range matches {
+				if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+					continue
+				}
+				if err := a.openFile(path); err != nil {
+					return "", err
+				}
+				opened++
+			}
+			if opened == 0 {
+				return "", fmt.Errorf("%s: no file matches", arg)
+			}
+			continue
+		}
+
+		path, line, col := parseFileArg(arg)
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			if root, err = filepath.Abs(path); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err := a.openFile(path); err != nil {
+			return "", err
+		}
+		if line > 0 {
+			if e := a.getEditor(); e != nil {
+				e.gotoLineCol(line-1, max(col-1, 0))
+			}
+		}
+	}
+	return root, nil
+}
+
+// parseFileArg splits a command line argument like "main.go:10:3" into the
+// path and the 1-based line and column, 0 when not given.
+func parseFileArg(arg string) (path string, line, col int) {
 	parts := strings.Split(arg, ":")
 	path = parts[0]
 	if len(parts) > 1 {
 		line, _ = strconv.Atoi(parts[1])
 	}
-	return path, line
+	if len(parts) > 2 {
+		col, _ = strconv.Atoi(parts[2])
+	}
+	return path, line, col
+}
+
+// parseLineSpec parses what follows ":" in the palette: a line "10", a line
+// and column "10:3", a jump from the cursor row "+10" or "-5", or a position
+// in the file "50%". It returns the 0-based row, within the n lines of the
+// text, and column.
+func parseLineSpec(spec string, row, n int) (int, int, bool) {
+	lineStr, colStr, hasCol := strings.Cut(spec, ":")
+	col := 0
+	if hasCol {
+		c, err := strconv.Atoi(colStr)
+		if err != nil || c < 1 {
+			return 0, 0, false
+		}
+		col = c - 1
+	}
+
+	switch {
+	case strings.HasSuffix(lineStr, "%"):
+		pct, err := strconv.Atoi(strings.TrimSuffix(lineStr, "%"))
+		if err != nil || pct < 0 || pct > 100 {
+			return 0, 0, false
+		}
+		row = (n - 1) * pct / 100
+	case strings.HasPrefix(lineStr, "+") || strings.HasPrefix(lineStr, "-"):
+		d, err := strconv.Atoi(lineStr)
+		if err != nil {
+			return 0, 0, false
+		}
+		row += d
+	default:
+		line, err := strconv.Atoi(lineStr)
+		if err != nil || line < 1 {
+			return 0, 0, false
+		}
+		row = line - 1
+	}
+	return min(max(row, 0), n-1), col, true
 }
 
 var _ ui.Focusable = (*App)(nil)
@@ -108,16 +235,24 @@ type App struct {
 	cmdBtn    *ui.Button
 	status    string
 
-	searchBar  *SearchBar
-	showSearch bool
-	clipboard  string // local cache for immediate paste; also synced to OS clipboard
+	searchBar    *SearchBar
+	showSearch   bool
+	explorer     *Explorer
+	showExplorer bool
+	palette      *Palette
+	clipboard    string // local cache for immediate paste; also synced to OS clipboard
 
-	leaderKeyActive bool
-	leaderTimer     *time.Timer
+	commands *commandRegistry // what keys, the palette and the cheat sheet call by ID
+	keymap   keymap
 
 	history        []historyEntry
 	historyPos     int
 	navigatingHist bool
+
+	histories map[string]*ui.History // of the inputs by name, see inputHistory
+	recent    []recentEntry          // files opened lately, see touchRecent
+	files     *fileIndex             // of the working tree, nil until indexFiles
+	symbols   *symbolIndex           // of the Go files of the tree, nil until indexSymbols
 }
 
 type historyEntry struct {
@@ -129,6 +264,7 @@ func newApp(m *ui.Manager) *App {
 	a := &App{
 		manager:    m,
 		historyPos: -1,
+		histories:  make(map[string]*ui.History),
 	}
 	a.newBtn = &ui.Button{
 		Text: "New",
@@ -144,9 +280,68 @@ func newApp(m *ui.Manager) *App {
 	a.saveBtn = &ui.Button{Text: "Save", OnClick: a.saveFile}
 	a.quitBtn = &ui.Button{Text: "Quit", OnClick: m.Stop}
 	a.searchBar = NewSearchBar(a)
+	a.explorer = newExplorer(a)
+	a.commands = newCommandRegistry()
+	for _, c := range a.defaultCommands() {
+		a.commands.register(c)
+	}
+	km, _ := buildKeymap(nil, a.commands)
+	a.setKeymap(km)
+	// a chord bound only in another context leaves its first key
+	// to the focused element, e.g. a text input
+	m.ChordEnabled = func(key string) bool {
+		return a.keymap.lookup(key, a.keyContext()) != ""
+	}
 	return a
 }
 
+// setKeymap replaces the keymap. Chords are bound in the manager,
+// which collects their keys before any element sees them. A chord bound
+// to no command isn't, so a user keymap can free its first key.
+func (a *App) setKeymap(km keymap) {
+	for _, b := range a.keymap {
+		if strings.Contains(b.Key, " ") {
+			a.manager.BindKey(b.Key, nil)
+		}
+	}
+	a.keymap = km
+	for _, b := range km {
+		if strings.Contains(b.Key, " ") && b.Command != "" {
+			key := b.Key
+			a.manager.BindKey(key, func() { a.runKey(key) })
+		}
+	}
+}
+
+// loadKeymap applies the user keymap file over the defaults,
+// problems are logged and shown in the status bar.
+func (a *App) loadKeymap() {
+	path, err := keymapPath()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	user, err := loadKeymapFile(path)
+	if err != nil {
+		log.Print(err)
+		a.setStatus(err.Error(), 10*time.Second)
+		return
+	}
+
+	km, errs := buildKeymap(user, a.commands)
+	a.setKeymap(km)
+	for _, err := range errs {
+		log.Print(err)
+	}
+	switch len(errs) {
+	case 0:
+	case 1:
+		a.setStatus(errs[0].Error(), 10*time.Second)
+	default:
+		a.setStatus(fmt.Sprintf("%v (and %d more)", errs[0], len(errs)-1), 10*time.Second)
+	}
+}
+
 // newTab returns a new editable buffer
 func (a *App) newTab(label string) *Editor {
 	tab := newTab(a, label)
@@ -162,7 +357,8 @@ func (a *App) closeTab(i int) {
 	}
 	tab := a.tabs[i]
 	editor := tab.editor
-	if !editor.Dirty {
+	// edits in a listing are dropped, like those of a search that is done again
+	if !editor.Dirty || tab.listing() {
 		a.deleteTab(i)
 		a.requestFocus()
 		return
@@ -219,6 +415,16 @@ func (a *App) deleteTab(i int) {
 	if i < 0 || i >= len(a.tabs) {
 		return
 	}
+	if s := a.tabs[i].search; s != nil {
+		s.cancel()
+	}
+	if p := a.tabs[i].preview; p != nil {
+		p.cancel()
+	}
+	if stop := a.tabs[i].stopFollow; stop != nil {
+		stop()
+	}
+	a.keepRecentPos(a.tabs[i])
 
 	a.tabs = slices.Delete(a.tabs, i, i+1)
 	if i < a.activeTab {
@@ -276,8 +482,8 @@ func (a *App) Layout(r ui.Rect) *ui.Node {
 	if a.status != "" {
 		statusBar.Append(ui.Spacer, ui.NewText(a.status))
 	}
-	if a.leaderKeyActive {
-		statusBar.Append(ui.Spacer, ui.NewText("Wait for key..."))
+	if keys, next := a.manager.PendingChord(); keys != "" {
+		statusBar.Append(ui.Spacer, ui.NewText(keys+" … "+strings.Join(next, ", ")))
 	}
 
 	mainStack.Append(
@@ -285,10 +491,14 @@ func (a *App) Layout(r ui.Rect) *ui.Node {
 		ui.PadH(statusBar, 1),
 	)
 
+	var view ui.Element = mainStack
+	if a.showExplorer {
+		view = ui.HStack(a.explorer, &ui.Divider{}, ui.Grow(mainStack))
+	}
 	return &ui.Node{
 		Element:  a,
 		Rect:     r,
-		Children: []*ui.Node{mainStack.Layout(r)},
+		Children: []*ui.Node{view.Layout(r)},
 	}
 }
 
@@ -328,68 +538,249 @@ func (a *App) OnBlur()  {}
 func (a *App) resetFind() {
 	a.showSearch = true
 	sb := a.searchBar
-	sb.matches = nil
-	sb.activeIndex = -1
+	sb.remember()
+	sb.showReplace = false
 
 	// reuse previous query or selected text, but select all for easy replacement
 	query := sb.input.String()
 	if e := a.getEditor(); e != nil {
 		if s := e.SelectedText(); s != "" {
 			query = s
-			sb.input.SetText(s)
+			if sb.opts.regex {
+				query = regexp.QuoteMeta(s)
+			}
 		}
 	}
+	// the buffer may have changed since the last search
+	sb.input.SetText(query)
 	sb.input.Select(0, len([]rune(query)))
 
 	a.manager.SetFocus(sb)
 }
 
-// handles app-level commands
-func (a *App) handleGlobalKey(ev *tcell.EventKey) bool {
-	switch strings.ToLower(ev.Name()) {
-	case "ctrl+s":
-		a.saveFile()
-		return true
-	case "ctrl+w":
-		a.closeTab(a.activeTab)
-		return true
-	case "ctrl+f":
-		a.resetFind()
-		return true
-	case "ctrl+k":
-		a.activateLeader()
-		return true
-	case "ctrl+p":
-		/*
-			if a.leaderKeyActive {
-				a.leaderKeyActive = false
-				if a.leaderTimer != nil {
-					a.leaderTimer.Stop()
+func (a *App) handleKey(ev *tcell.EventKey) bool {
+	return a.runKey(ui.KeyName(ev))
+}
+
+// runKey runs the command bound to the key or chord in the current context,
+// reports whether there was one enabled.
+func (a *App) runKey(key string) bool {
+	return a.commands.run(a.keymap.lookup(key, a.keyContext()))
+}
+
+// keyContext reports which of keyContexts are active.
+func (a *App) keyContext() map[string]bool {
+	focused := a.manager.Focused()
+	e := a.getEditor()
+	return map[string]bool{
+		"editorFocus":    e != nil && focused == ui.Element(e),
+		"completionOpen": e != nil && e.completionOpen(),
+		"snippetActive":  e != nil && e.snippet != nil,
+		"paletteOpen":    a.palette != nil && focused == ui.Element(a.palette),
+		"searchOpen":     a.showSearch,
+		"searchFocus":    focused == ui.Element(a.searchBar),
+		"replaceFocus":   focused == ui.Element(a.searchBar.replace),
+		"resultsFocus":   e != nil && focused == ui.Element(e) && a.activeSearch() != nil,
+		"previewFocus":   e != nil && focused == ui.Element(e) && a.activePreview() != nil,
+		"explorerFocus":  a.explorerFocused(),
+	}
+}
+
+func (a *App) closeSearch() {
+	a.searchBar.remember()
+	a.showSearch = false
+	a.searchBar.highlight(nil)
+	a.requestFocus()
+}
+
+// defaultCommands returns the commands of the app, in the order the
+// palette lists them.
+func (a *App) defaultCommands() []command {
+	// edit wraps a command on the active editor
+	edit := func(fn func(e *Editor)) func() {
+		return func() {
+			if e := a.getEditor(); e != nil {
+				fn(e)
+			}
+		}
+	}
+	// write wraps a command that changes the text of the active editor
+	write := func(fn func(e *Editor)) func() {
+		return edit(func(e *Editor) {
+			if !e.ReadOnly {
+				fn(e)
+			}
+		})
+	}
+	palette := func(fn func(p *Palette)) func() {
+		return func() {
+			if a.palette != nil {
+				fn(a.palette)
+			}
+		}
+	}
+	searchOpen := func() bool { return a.showSearch }
+	explorerShown := func() bool { return a.showExplorer }
+	hasTab := func() bool { return len(a.tabs) > 0 }
+	// goTool runs the go command with args, showing its output in a tab if it fails
+	goTool := func(args ...string) func() {
+		return func() {
+			name := "go " + args[0]
+			cmd := exec.Command("go", args...)
+			cmd.Dir = a.rootDir()
+			go func() {
+				defer a.manager.Refresh()
+				defer a.requestFocus()
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					buf := a.newTab(name + "...")
+					buf.SetText(string(out))
+					return
 				}
-				a.showPalette(">") // Ctrl+K Ctrl+P command mode
+				a.setStatus(name+" ok", 5*time.Second)
+			}()
+		}
+	}
+
+	return []command{
+		{ID: "palette.files", Category: "Go to", Title: "File", Key: "ctrl+o", Run: func() { a.showPalette("") }},
+		{ID: "palette.symbols", Category: "Go to", Title: "Symbol", Key: "ctrl+r", Run: func() { a.showPalette("@") }},
+		{ID: "palette.workspaceSymbols", Category: "Go to", Title: "Symbol in Workspace", Run: func() { a.showPalette("#") }},
+		{ID: "palette.commands", Key: "ctrl+p", Hidden: true, Run: func() { a.showPalette(">") }},
+		{ID: "palette.next", Hidden: true, Run: palette(func(p *Palette) {
+			if !p.input.RecallNext() {
+				p.list.Next()
 			}
-		*/
-		a.showPalette(">")
-		return true
-	case "ctrl+r":
-		a.showPalette("@")
-		return true
-	case "ctrl+o":
-		a.showPalette("")
-		return true
-	case "ctrl+t":
-		a.newTab("untitled")
-		a.requestFocus()
-		return true
-	case "esc":
-		if a.showSearch {
-			a.showSearch = false
+		})},
+		{ID: "palette.prev", Hidden: true, Run: palette(func(p *Palette) {
+			if !p.canRecall() || !p.input.RecallPrev() {
+				p.list.Prev()
+			}
+		})},
+		{ID: "palette.accept", Hidden: true, Run: palette(func(p *Palette) { p.list.Activate() })},
+
+		{ID: "goto.definition", Category: "Go to", Title: "Definition", Run: edit(func(e *Editor) { e.gotoDefinition() })},
+		{ID: "goto.firstLine", Category: "Go to", Title: "First Line", Run: edit(func(e *Editor) { e.gotoLine(0) })},
+		{ID: "goto.lastLine", Category: "Go to", Title: "Last Line", Run: edit(func(e *Editor) { e.gotoLine(e.Len() - 1) })},
+		{ID: "goto.back", Category: "Jump", Title: "Back", Run: a.goBack},
+		{ID: "goto.forward", Category: "Jump", Title: "Forward", Run: a.goForward},
+
+		{ID: "file.new", Title: "New File", Category: "File", Key: "ctrl+t", Run: func() {
+			a.newTab("untitled")
 			a.requestFocus()
-			return true
-		}
-		return true
+		}},
+		{ID: "file.save", Key: "ctrl+s", Enabled: hasTab, Run: a.saveFile},
+		{ID: "file.close", Key: "ctrl+w", Enabled: hasTab, Run: func() { a.closeTab(a.activeTab) }},
+		{ID: "file.openRecent", Run: a.showRecent},
+		{ID: "file.clearRecent", Category: "File", Title: "Clear Recent Files", Run: a.clearRecent},
+
+		{ID: "find.open", Category: "Find", Title: "Find", Key: "ctrl+f", Run: a.resetFind},
+		{ID: "find.replace", Category: "Find", Title: "Replace", Key: "alt+f", Run: func() {
+			// a second press moves on to the replacement
+			if !a.searchBar.showReplace {
+				a.resetFind()
+				a.searchBar.showReplace = true
+				return
+			}
+			a.searchBar.focusReplace()
+		}},
+		{ID: "find.next", Hidden: true, Run: func() { a.searchBar.navigate(true) }},
+		{ID: "find.prev", Hidden: true, Run: func() { a.searchBar.navigate(false) }},
+		{ID: "find.older", Hidden: true, Run: func() { a.searchBar.recall(true) }},
+		{ID: "find.newer", Hidden: true, Run: func() { a.searchBar.recall(false) }},
+		{ID: "find.close", Hidden: true, Run: a.closeSearch},
+		{ID: "find.replaceOne", Hidden: true, Run: a.searchBar.replaceOne},
+		{ID: "find.replaceAll", Hidden: true, Run: a.searchBar.replaceAll},
+		{ID: "find.focusReplace", Hidden: true, Run: a.searchBar.focusReplace},
+		{ID: "find.focusFind", Hidden: true, Run: func() { a.manager.SetFocus(a.searchBar) }},
+		{ID: "find.toggleRegex", Enabled: searchOpen, Run: func() { a.searchBar.toggle(&a.searchBar.opts.regex) }},
+		{ID: "find.toggleCase", Enabled: searchOpen, Run: func() { a.searchBar.toggle(&a.searchBar.opts.caseSensitive) }},
+		{ID: "find.toggleWholeWord", Enabled: searchOpen, Run: func() { a.searchBar.toggle(&a.searchBar.opts.wholeWord) }},
+		{ID: "find.toggleSmartCase", Enabled: searchOpen, Run: func() { a.searchBar.toggle(&a.searchBar.opts.smartCase) }},
+
+		{ID: "find.inFiles", Category: "Find", Title: "Find in Files", Key: "ctrl+k ctrl+f", Run: a.promptFindInFiles},
+		{ID: "find.cancelInFiles", Category: "Find", Title: "Cancel Find in Files",
+			Enabled: func() bool { s := a.activeSearch(); return s != nil && s.running },
+			Run:     func() { a.cancelFindInFiles() }},
+		{ID: "find.commitResults", Category: "Find", Title: "Commit Results",
+			Enabled: func() bool { return a.activeSearch() != nil },
+			Run:     a.commitResults},
+		{ID: "find.replaceInFiles", Category: "Find", Title: "Replace in Files", Key: "ctrl+k ctrl+r", Run: a.replaceInFiles},
+		{ID: "results.open", Hidden: true, Run: a.openResult},
+		{ID: "results.cancel", Hidden: true, Run: func() {
+			if !a.cancelFindInFiles() {
+				a.commands.run("edit.cancel")
+			}
+		}},
+		{ID: "replace.toggle", Hidden: true, Run: a.toggleReplace},
+		{ID: "replace.open", Hidden: true, Run: a.openChange},
+		{ID: "replace.apply", Category: "Replace", Title: "Apply Changes",
+			Enabled: func() bool { return a.activePreview() != nil },
+			Run:     a.applyReplace},
+		{ID: "replace.cancel", Hidden: true, Run: func() {
+			if !a.cancelReplace() {
+				a.commands.run("edit.cancel")
+			}
+		}},
+
+		{ID: "explorer.toggle", Category: "View", Title: "Toggle Explorer", Key: "ctrl+k ctrl+b", Run: a.toggleExplorer},
+		{ID: "explorer.focus", Category: "View", Title: "Focus Explorer", Key: "ctrl+k ctrl+e", Run: a.focusExplorer},
+		{ID: "explorer.reveal", Category: "Explorer", Title: "Reveal Active File", Enabled: hasTab, Run: a.revealActiveFile},
+		{ID: "explorer.newFile", Enabled: explorerShown, Run: func() { a.explorerCreate(false) }},
+		{ID: "explorer.newFolder", Enabled: explorerShown, Run: func() { a.explorerCreate(true) }},
+		{ID: "explorer.rename", Enabled: explorerShown, Run: a.explorerRename},
+		{ID: "explorer.delete", Enabled: explorerShown, Run: a.explorerDelete},
+
+		{ID: "cursor.up", Hidden: true, Run: edit(func(e *Editor) { e.MoveUp() })},
+		{ID: "cursor.down", Hidden: true, Run: edit(func(e *Editor) { e.MoveDown() })},
+		{ID: "cursor.left", Hidden: true, Run: edit(func(e *Editor) { e.MoveLeft() })},
+		{ID: "cursor.right", Hidden: true, Run: edit(func(e *Editor) { e.MoveRight() })},
+		{ID: "cursor.lineStart", Hidden: true, Run: edit(func(e *Editor) { e.MoveLineStart() })},
+		{ID: "cursor.lineEnd", Hidden: true, Run: edit(func(e *Editor) { e.MoveLineEnd() })},
+
+		{ID: "edit.newline", Hidden: true, Run: write(func(e *Editor) { e.InsertNewline() })},
+		{ID: "edit.deleteLeft", Hidden: true, Run: write(func(e *Editor) {
+			open := e.completionOpen()
+			e.DeleteBackward()
+			if open {
+				e.updateCompletion(false)
+			}
+		})},
+		{ID: "edit.tab", Hidden: true, Run: write(func(e *Editor) { e.tab() })},
+		{ID: "edit.cancel", Hidden: true, Run: edit(func(e *Editor) {
+			if !e.Cancel() && a.showSearch {
+				a.closeSearch()
+			}
+		})},
+		{ID: "edit.undo", Run: write(func(e *Editor) { e.Undo() })},
+		{ID: "edit.redo", Run: write(func(e *Editor) { e.Redo() })},
+		{ID: "edit.copy", Run: edit(func(e *Editor) { e.copy() })},
+		{ID: "edit.cut", Run: write(func(e *Editor) { e.cut() })},
+		{ID: "edit.paste", Run: write(func(e *Editor) { e.paste() })},
+		{ID: "edit.selectWord", Run: edit(func(e *Editor) { e.selectWordOrNext() })},
+		{ID: "edit.selectLine", Run: edit(func(e *Editor) { e.ExpandSelectionToLine() })},
+		{ID: "edit.selectBrackets", Run: edit(func(e *Editor) { e.ExpandSelectionToBrackets() })},
+		{ID: "edit.upperCase", Run: write(func(e *Editor) { e.changeCase(strings.ToUpper) })},
+		{ID: "edit.lowerCase", Run: write(func(e *Editor) { e.changeCase(strings.ToLower) })},
+
+		{ID: "completion.show", Run: write(func(e *Editor) { e.updateCompletion(true) })},
+		{ID: "completion.next", Hidden: true, Run: edit(func(e *Editor) { e.moveCompletion(1) })},
+		{ID: "completion.prev", Hidden: true, Run: edit(func(e *Editor) { e.moveCompletion(-1) })},
+		{ID: "completion.accept", Hidden: true, Run: edit(func(e *Editor) { e.acceptCompletion() })},
+		{ID: "completion.close", Hidden: true, Run: edit(func(e *Editor) { e.closeCompletion() })},
+
+		{ID: "snippet.next", Hidden: true, Run: edit(func(e *Editor) { e.NextSnippetField() })},
+		{ID: "snippet.prev", Hidden: true, Run: edit(func(e *Editor) { e.PrevSnippetField() })},
+		{ID: "snippet.exit", Hidden: true, Run: edit(func(e *Editor) { e.ExitSnippet() })},
+
+		{ID: "theme.breakers", Category: "Color Theme", Title: "Breaks", Run: func() { ui.Theme = ui.Breakers }},
+		{ID: "theme.mariana", Category: "Color Theme", Title: "Mariana", Run: func() { ui.Theme = ui.Mariana }},
+		{ID: "go.build", Run: goTool("build")},
+		{ID: "go.test", Run: goTool("test", "./...")},
+
+		{ID: "app.help", Category: "Help", Title: "Keyboard Shortcuts", Key: "f1", Run: func() { a.showPalette("?") }},
+		{ID: "app.quit", Run: a.manager.Stop},
 	}
-	return false
 }
 
 func (a *App) getEditor() *Editor {
@@ -400,37 +791,39 @@ func (a *App) getEditor() *Editor {
 }
 
 func (a *App) showPalette(prefix string) {
-	p := NewPalette()
+	p := NewPalette(a)
+	a.palette = p
 	p.input.OnChange = func() {
 		text := p.input.String()
 		p.list.Clear()
 		p.list.Index = 0
+		p.list.OnSelect = nil
 
 		switch {
 		case strings.HasPrefix(text, ":"):
 			// 1. Go to Line
-			lineStr := text[1:]
-			n, err := strconv.Atoi(lineStr)
-			if err != nil || n < 1 {
+			e := a.getEditor()
+			if e == nil {
+				return
+			}
+			row, col, ok := parseLineSpec(text[1:], e.Pos.Row, e.Len())
+			if !ok {
 				return
 			}
 
-			p.list.Append(ui.ListItem{Name: "Go to Line " + lineStr, Value: n - 1})
+			name := fmt.Sprintf("Go to Line %d", row+1)
+			if strings.Contains(text[1:], ":") {
+				name += fmt.Sprintf(", Column %d", col+1)
+			}
+			p.list.Append(ui.ListItem{Name: name, Value: Pos{Row: row, Col: col}})
 			p.list.OnSelect = func(item ui.ListItem) {
-				lineNum := item.Value.(int)
-				if e := a.getEditor(); e != nil {
-					e.gotoLine(lineNum)
-				}
+				pos := item.Value.(Pos)
+				e.gotoLineCol(pos.Row, pos.Col)
 				a.requestFocus()
 			}
 
 		case strings.HasPrefix(text, "@"):
 			// 2. Go to Symbol
-			query := strings.ToLower(text[1:])
-			// Split by spaces or dots
-			words := strings.FieldsFunc(query, func(r rune) bool {
-				return r == ' ' || r == '.'
-			})
 			editor := a.getEditor()
 			if editor == nil {
 				return
@@ -441,225 +834,82 @@ func (a *App) showPalette(prefix string) {
 				a.requestFocus()
 			}
 
-			for _, sym := range editor.symbols {
-				ok := true
-				for _, word := range words {
-					if word == "" {
-						continue
-					}
-					if !strings.Contains(strings.ToLower(sym.FullName), word) {
-						ok = false
-						break
-					}
-				}
-				if ok {
-					p.list.Append(ui.ListItem{Name: sym.FullName, Value: sym.Line})
-				}
+			// dots separate words too, so "app.open" finds App.openFile
+			query := strings.ReplaceAll(text[1:], ".", " ")
+			for _, r := range fuzzyFilter(query, editor.symbols, func(s symbol) string { return s.FullName }) {
+				p.list.Append(ui.ListItem{Name: r.text, Value: r.item.Line, Matches: r.positions})
 			}
 
+		case strings.HasPrefix(text, "#"):
+			a.fillWorkspaceSymbolMode(p, text[1:])
 		case strings.HasPrefix(text, ">"):
 			a.fillCommandMode(p, text[1:])
+		case strings.HasPrefix(text, "?"):
+			a.fillHelpMode(p, text[1:])
 		default:
 			a.fillFileSearchMode(p, text)
 		}
+		a.rememberPalette(p)
 	}
 
 	p.input.SetText(prefix)
 	a.manager.Overlay(p, "top")
 }
 
-func (a *App) fillCommandMode(p *Palette, query string) {
-	words := strings.Fields(query)
-	commands := []struct {
-		name   string
-		action func()
-	}{
-		{"Color Theme: Breaks", func() {
-			ui.Theme = ui.Breakers
-			a.requestFocus()
-		}},
-		{"Color Theme: Mariana", func() {
-			ui.Theme = ui.Mariana
-			a.requestFocus()
-		}},
-		{"Goto Definition", func() {
-			if e := a.getEditor(); e != nil {
-				e.gotoDefinition()
-			}
-			a.requestFocus()
-		}},
-		{"Goto Symbol", func() { a.showPalette("@") }},
-		{"Jump Back", a.goBack},
-		{"Jump Forward", a.goForward},
-		{"New File", func() { a.newTab("untitled"); a.requestFocus() }},
-		{"GoBuild", func() {
-			go func() {
-				defer a.manager.Refresh()
-				defer a.requestFocus()
-				out, err := exec.Command("go", "build").CombinedOutput()
-				if err != nil {
-					buf := a.newTab("go build...")
-					buf.SetText(string(out))
-					return
-				}
-				a.setStatus("go build ok", 5*time.Second)
-			}()
-		}},
-		{"GoTest", func() {
-			go func() {
-				defer a.manager.Refresh()
-				defer a.requestFocus()
-				out, err := exec.Command("go", "test", "./...").CombinedOutput()
-				if err != nil {
-					buf := a.newTab("go test...")
-					buf.SetText(string(out))
-					return
-				}
-				a.setStatus("go test ok", 5*time.Second)
-			}()
-		}},
-		{"Quit", a.manager.Stop},
-	}
-
-	for _, cmd := range commands {
-		ok := true
-		for _, word := range words {
-			if word == "" {
-				continue
-			}
-			if !strings.Contains(strings.ToLower(cmd.name), word) {
-				ok = false
-				break
-			}
-		}
-		if ok {
-			p.list.Append(ui.ListItem{Name: cmd.name, Value: cmd.action})
-		}
+// rememberPalette wraps the selection of the palette to add the query to
+// its history, for commands the command itself, so it can run again.
+func (a *App) rememberPalette(p *Palette) {
+	onSelect := p.list.OnSelect
+	if onSelect == nil {
+		return
 	}
-
+	query := p.input.String()
 	p.list.OnSelect = func(item ui.ListItem) {
-		action := item.Value.(func())
-		action()
+		entry := query
+		if strings.HasPrefix(query, ">") {
+			entry = ">" + item.Name
+		}
+		p.input.History.Add(entry)
+		onSelect(item)
 	}
 }
 
+// maxPaletteItems bounds the files or symbols listed in the palette, the
+// list scrolls but more than the best matches are not worth drawing.
+const maxPaletteItems = 1000
+
 func (a *App) fillFileSearchMode(p *Palette, query string) {
 	p.list.OnSelect = func(item ui.ListItem) {
 		a.openFile(item.Value.(string))
 		a.requestFocus()
 	}
 
-	query = strings.ToLower(query)
-	filter := make(map[string]bool)
-	currentDir, _ := os.Getwd()
-	ignoreRules := loadGitignoreRules(filepath.Join(currentDir, ".gitignore"))
+	root := a.rootDir()
 
-	// list opened tabs first
-	for _, t := range a.tabs {
-		path := t.path
-		// show relative path if possible
-		if filepath.IsAbs(t.path) {
-			if rel, err := filepath.Rel(currentDir, t.path); err == nil && !strings.HasPrefix(rel, "..") {
-				path = rel
-			}
-		}
-
-		if query == "" || strings.Contains(strings.ToLower(path), query) {
-			p.list.Append(ui.ListItem{Name: path, Value: path})
-			filter[path] = true
-			if p.list.Len() >= 10 {
-				return
-			}
+	// recent files come first, then opened tabs, then the files of the tree
+	var paths []string
+	known := make(map[string]string) // path to open by the path shown
+	add := func(path string) {
+		shown := displayPath(root, path)
+		if _, ok := known[shown]; !ok {
+			paths = append(paths, shown)
+			known[shown] = path
 		}
 	}
-
-	// list files in current directory
-	entries, _ := os.ReadDir(".")
-	for _, entry := range entries {
-		name := entry.Name()
-		if entry.IsDir() || filter[name] || strings.HasPrefix(name, ".") {
-			continue
-		}
-		if isGitignored(name, name, ignoreRules) {
-			continue
-		}
-		if query != "" && !strings.Contains(strings.ToLower(name), query) {
-			continue
-		}
-		p.list.Append(ui.ListItem{Name: name, Value: name})
-		if p.list.Len() >= 10 {
-			return
-		}
+	for _, r := range a.recent {
+		add(r.Path)
 	}
-}
-
-type gitignoreRule struct {
-	pattern  string
-	negate   bool
-	hasSlash bool
-	dirOnly  bool
-}
-
-func loadGitignoreRules(path string) []gitignoreRule {
-	bs, err := os.ReadFile(path)
-	if err != nil {
-		return nil
+	for _, t := range a.tabs {
+		add(t.path)
 	}
-	lines := strings.Split(string(bs), "\n")
-	rules := make([]gitignoreRule, 0, len(lines))
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		negate := false
-		if strings.HasPrefix(line, "!") {
-			negate = true
-			line = strings.TrimSpace(line[1:])
-			if line == "" {
-				continue
-			}
-		}
-		dirOnly := strings.HasSuffix(line, "/")
-		if dirOnly {
-			line = strings.TrimSuffix(line, "/")
-			if line == "" {
-				continue
-			}
-		}
-		line = strings.TrimPrefix(line, "/")
-		rules = append(rules, gitignoreRule{
-			pattern:  line,
-			negate:   negate,
-			hasSlash: strings.Contains(line, "/"),
-			dirOnly:  dirOnly,
-		})
+	for _, rel := range a.files.list() {
+		add(filepath.Join(root, rel))
 	}
-	return rules
-}
 
-func isGitignored(relPath, name string, rules []gitignoreRule) bool {
-	if len(rules) == 0 {
-		return false
+	results := fuzzyFilter(query, paths, func(s string) string { return s })
+	for _, r := range results[:min(len(results), maxPaletteItems)] {
+		p.list.Append(ui.ListItem{Name: r.text, Value: known[r.item], Matches: r.positions})
 	}
-	ignored := false
-	for _, r := range rules {
-		if r.dirOnly {
-			continue
-		}
-		var target string
-		if r.hasSlash {
-			target = filepath.ToSlash(relPath)
-		} else {
-			target = name
-		}
-		matched, err := filepath.Match(r.pattern, target)
-		if err != nil || !matched {
-			continue
-		}
-		ignored = !r.negate
-	}
-	return ignored
 }
 
 func (a *App) openFile(name string) error {
@@ -672,6 +922,7 @@ func (a *App) openFile(name string) error {
 	for i, tab := range a.tabs {
 		if tab.path == abs {
 			a.activeTab = i
+			a.touchRecent(abs)
 			a.recordJump()
 			return nil
 		}
@@ -685,6 +936,8 @@ func (a *App) openFile(name string) error {
 	buf := a.newTab(abs)
 	buf.SetText(string(bs))
 	buf.updateSymbols()
+	a.restoreRecentPos(abs, buf)
+	a.touchRecent(abs)
 	a.recordJump()
 	return nil
 }
@@ -713,7 +966,8 @@ func (a *App) pushHistory(path string, pos Pos) {
 }
 
 func (a *App) recordJump() {
-	if e := a.getEditor(); e != nil && a.tabs[a.activeTab].path != "" {
+	// the listing tabs are not places to come back to
+	if e := a.getEditor(); e != nil && a.tabs[a.activeTab].path != "" && !a.tabs[a.activeTab].listing() {
 		a.pushHistory(a.tabs[a.activeTab].path, e.Pos)
 	}
 }
@@ -760,7 +1014,11 @@ func (a *App) saveFile() {
 	}
 	tab := a.tabs[a.activeTab]
 	editor := tab.editor
-	if !editor.Dirty {
+	if tab.search != nil {
+		a.commitResults()
+		return
+	}
+	if !editor.Dirty || tab.listing() {
 		a.requestFocus()
 		return
 	}
@@ -904,15 +1162,34 @@ func (a *App) writeFile(path string, e *Editor) error {
 
 	e.Dirty = false
 	e.updateSymbols()
+	a.savedFile(path, bs)
 	return nil
 }
 
+// savedFile brings what the workspace knows of the file at path up to
+// date, once bs is written to it.
+func (a *App) savedFile(path string, bs []byte) {
+	a.symbols.update(path, bs)
+	if a.showExplorer {
+		a.explorer.updateChanges()
+	}
+}
+
 type tab struct {
 	a        *App
 	path     string
 	closeBtn *ui.Button
 	editor   *Editor
 	hovered  bool
+	search   *fileSearch     // set for the Find in Files results tab
+	preview  *replacePreview // set for the Replace in Files preview tab
+
+	stopFollow context.CancelFunc // set for a tab following a reader, see openReader
+}
+
+// listing reports whether the tab lists results rather than holding a file.
+func (t *tab) listing() bool {
+	return t.search != nil || t.preview != nil
 }
 
 func newTab(root *App, label string) *tab {
@@ -929,15 +1206,32 @@ func newTab(root *App, label string) *tab {
 		}
 	})
 	e := NewEditor(root)
-	ext := filepath.Ext(label)
-	switch ext {
+	e.setLanguage(label)
+	t.editor = e
+	return t
+}
+
+// setLanguage sets up the highlighting, snippets and completion of e for
+// the language of the file at path, known by its extension.
+func (e *Editor) setLanguage(path string) {
+	e.Highlighter = nil
+	e.snippets = nil
+	e.completers = []completer{symbolCompleter(e), wordCompleter(e.app)}
+	switch filepath.Ext(path) {
 	case ".go":
 		e.Highlighter = highlightGo
+		e.snippets = snippetsFor("go")
+		e.completers = append(e.completers,
+			keywordCompleter("keyword", goKeywords),
+			keywordCompleter("builtin", goBuiltins),
+		)
 	case ".md", ".markdown":
 		e.Highlighter = highlightMarkdown
+		e.snippets = snippetsFor("markdown")
+	}
+	if len(e.snippets) > 0 {
+		e.completers = append(e.completers, snippetCompleter(e))
 	}
-	t.editor = e
-	return t
 }
 
 const tabItemWidth = 18
@@ -996,22 +1290,44 @@ func (t *tab) OnMouseLeave() {
 func (t *tab) OnMouseMove(rx, ry int) {}
 
 type Palette struct {
+	app   *App
 	input *proxyInput
 	list  *ui.List
 }
 
-func NewPalette() *Palette {
+func NewPalette(a *App) *Palette {
 	p := &Palette{
+		app:  a,
 		list: new(ui.List),
 	}
 	// Use proxyInput to delegate key handling to Palette
 	p.input = &proxyInput{
-		Input:  new(ui.Input),
+		Input:  &ui.Input{History: a.inputHistory("palette")},
 		parent: p,
 	}
 	return p
 }
 
+// paletteModes are the prefixes that switch the palette from finding files.
+var paletteModes = []string{">", "@", "#", ":", "?"}
+
+// mode returns the prefix of the mode the palette is in, "" for finding files.
+func (p *Palette) mode() string {
+	text := p.input.String()
+	for _, m := range paletteModes {
+		if strings.HasPrefix(text, m) {
+			return m
+		}
+	}
+	return ""
+}
+
+// canRecall reports whether up recalls the history, also when only the
+// prefix of a mode is typed, as the palette opens with it.
+func (p *Palette) canRecall() bool {
+	return p.input.CanRecall() || slices.Contains(paletteModes, p.input.String())
+}
+
 func (p *Palette) SetText(text string) {
 	p.input.SetText(text)
 	p.input.OnFocus()
@@ -1044,19 +1360,10 @@ func (p *Palette) Draw(ui.Screen, ui.Rect) {
 }
 
 func (p *Palette) HandleKey(ev *tcell.EventKey) bool {
-	consumed := true
-	switch ev.Key() {
-	case tcell.KeyDown, tcell.KeyCtrlN:
-		p.list.Next()
-	case tcell.KeyUp, tcell.KeyCtrlP:
-		p.list.Prev()
-	case tcell.KeyEnter:
-		p.list.Activate()
-	default:
-		p.input.HandleKey(ev)
-		consumed = false
+	if p.app.handleKey(ev) {
+		return true
 	}
-	return consumed
+	return p.input.HandleKey(ev)
 }
 
 func (p *Palette) OnFocus() { p.input.OnFocus() }
@@ -1113,235 +1420,6 @@ func extractSymbols(content string) []symbol {
 	return symbols
 }
 
-type SearchBar struct {
-	a           *App
-	input       *proxyInput
-	btnPrev     *ui.Button
-	btnNext     *ui.Button
-	closeBtn    *ui.Button
-	matches     []Pos
-	activeIndex int // -1 表示尚未進行導航定位
-}
-
-func NewSearchBar(r *App) *SearchBar {
-	sb := &SearchBar{a: r, activeIndex: -1}
-	sb.input = &proxyInput{
-		Input:  new(ui.Input),
-		parent: sb,
-	}
-	// Lazy Evaluation:
-	// 當文字改變時，僅標記狀態為「需要重新掃描」，但不立即掃描
-	// 真正的計算成本被推遲到了使用者按下 Enter、SelectNext 或 SelectPrev 的那一刻
-	sb.input.OnChange = func() {
-		sb.matches = nil
-		sb.activeIndex = -1
-	}
-
-	sb.btnPrev = ui.NewButton("↑", func() { sb.navigate(false) })
-	sb.btnNext = ui.NewButton("↓", func() { sb.navigate(true) })
-	sb.closeBtn = ui.NewButton("✕", func() {
-		sb.a.showSearch = false
-		sb.a.requestFocus()
-	})
-	return sb
-}
-
-func (sb *SearchBar) updateMatches() {
-	sb.matches = nil
-	sb.activeIndex = -1
-
-	query := strings.ToLower(sb.input.String())
-	if query == "" {
-		return
-	}
-
-	editor := sb.a.getEditor()
-	if editor == nil {
-		return
-	}
-
-	content := editor.String()
-	lowerContent := strings.ToLower(content)
-
-	currentPos := 0
-	lineCount := 0
-	lastLineStart := 0
-
-	for {
-		idx := strings.Index(lowerContent[currentPos:], query)
-		if idx == -1 {
-			break
-		}
-
-		// 絕對座標
-		matchPos := currentPos + idx
-
-		// 計算從上一次匹配到現在經過了多少個換行符
-		// 這樣只需要掃描匹配點之間的區間
-		for i := currentPos; i < matchPos; i++ {
-			if content[i] == '\n' {
-				lineCount++
-				lastLineStart = i + 1
-			}
-		}
-
-		// 處理中文寬度：將 Byte 偏移量轉為 Rune 偏移量
-		// 只需要計算從該行起始 (lastLineStart) 到 匹配點 (matchPos) 之間有多少個 UTF-8 Rune
-		linePrefix := content[lastLineStart:matchPos]
-		runeCol := utf8.RuneCountInString(linePrefix)
-
-		sb.matches = append(sb.matches, Pos{
-			Row: lineCount,
-			Col: runeCol,
-		})
-
-		currentPos = matchPos + len(query)
-	}
-}
-
-// 根據編輯器當前游標位置，找到最接近的匹配項索引
-func (sb *SearchBar) setInitialActiveIndex() {
-	if len(sb.matches) == 0 {
-		return
-	}
-
-	tab := sb.a.tabs[sb.a.activeTab]
-	e := tab.editor
-
-	// 尋找第一個在游標位置之後的匹配項
-	for i, m := range sb.matches {
-		if m.Row > e.Pos.Row || (m.Row == e.Pos.Row && m.Col >= e.Pos.Col) {
-			sb.activeIndex = i
-			return
-		}
-	}
-
-	// 若游標已在所有匹配項之後，則循環回第一個
-	sb.activeIndex = 0
-}
-
-func (sb *SearchBar) navigate(forward bool) {
-	// 只有在真正需要結果時才更新 matches
-	if sb.matches == nil {
-		sb.updateMatches()
-	}
-
-	count := len(sb.matches)
-	if count == 0 {
-		return
-	}
-
-	// 首次導航：尋找最接近游標的匹配項
-	if sb.activeIndex == -1 {
-		sb.setInitialActiveIndex()
-		// 如果是向上找(Prev)，在定位後需再往前退一格
-		if !forward {
-			sb.activeIndex = (sb.activeIndex - 1 + count) % count
-		}
-	} else {
-		// 常規移動
-		if forward {
-			sb.activeIndex = (sb.activeIndex + 1) % count
-		} else {
-			sb.activeIndex = (sb.activeIndex - 1 + count) % count
-		}
-	}
-
-	sb.syncEditor()
-}
-
-func (sb *SearchBar) syncEditor() {
-	m := sb.matches[sb.activeIndex]
-	editor := sb.a.getEditor()
-	if editor == nil {
-		return
-	}
-	queryLen := utf8.RuneCountInString(sb.input.String())
-	editor.CenterRow(m.Row)
-	editor.SetSelection(m, Pos{Row: m.Row, Col: m.Col + queryLen})
-}
-
-func (sb *SearchBar) Layout(r ui.Rect) *ui.Node {
-	countStr := " 0/0 "
-	if len(sb.matches) > 0 {
-		displayIdx := sb.activeIndex + 1
-		if sb.activeIndex == -1 {
-			displayIdx = 0
-		}
-		countStr = fmt.Sprintf(" %d/%d ", displayIdx, len(sb.matches))
-	}
-
-	view := ui.HStack(
-		ui.PadH(ui.NewText("Find:"), 1),
-		ui.Grow(sb.input),
-		ui.PadH(ui.NewText(countStr), 1),
-		sb.btnPrev,
-		sb.btnNext,
-		sb.closeBtn,
-	)
-	return &ui.Node{
-		Element:  sb,
-		Rect:     r,
-		Children: []*ui.Node{view.Layout(r)},
-	}
-}
-
-func (sb *SearchBar) Size() (int, int) {
-	return 10, 1
-}
-
-func (sb *SearchBar) Draw(s ui.Screen, r ui.Rect) {}
-
-func (sb *SearchBar) HandleKey(ev *tcell.EventKey) bool {
-	consumed := true
-	switch ev.Key() {
-	case tcell.KeyEnter:
-		sb.navigate(true)
-	case tcell.KeyUp, tcell.KeyCtrlP:
-		sb.navigate(false)
-	case tcell.KeyDown, tcell.KeyCtrlN:
-		sb.navigate(true)
-	case tcell.KeyESC:
-		sb.a.showSearch = false
-		sb.a.requestFocus()
-	default:
-		sb.input.HandleKey(ev)
-		consumed = false
-	}
-	return consumed
-}
-
-func (sb *SearchBar) OnFocus() {
-	// make TextInput show cursor
-	sb.input.OnFocus()
-}
-func (sb *SearchBar) OnBlur() { sb.input.OnBlur() }
-
-// proxyInput delegates focus to its parent element
-type proxyInput struct {
-	*ui.Input
-	parent ui.Element
-}
-
-func (p *proxyInput) Layout(r ui.Rect) *ui.Node {
-	return &ui.Node{Element: p, Rect: r}
-}
-
-func (p *proxyInput) FocusTarget() ui.Element {
-	return p.parent
-}
-
-func (a *App) activateLeader() {
-	a.leaderKeyActive = true
-	if a.leaderTimer != nil {
-		a.leaderTimer.Stop()
-	}
-	a.leaderTimer = time.AfterFunc(2*time.Second, func() {
-		a.leaderKeyActive = false
-		a.manager.Refresh()
-	})
-}
-
 // detects if terminal has a light background via COLORFGBG.
 // iTerm2 sets this as "foreground;background".
 // Background 7 or 15 indicates light, 0-6 and 8 indicate dark.
@@ -1362,6 +1440,16 @@ type Editor struct {
 	*editor
 	app     *App
 	symbols []symbol
+
+	completers      []completer // sources of the completion popup, in rank order
+	completion      *ui.List    // the completion popup, nil when closed
+	completionStart int         // column of the word being completed
+	keepCompletion  bool        // whether the last key worked with the popup
+
+	snippets []snippet // snippets of the file's language
+
+	words        []string // of the text, see bufferWords
+	wordsVersion int      // the version of the text words is of
 }
 
 func NewEditor(r *App) *Editor {
@@ -1371,6 +1459,8 @@ func NewEditor(r *App) *Editor {
 	}
 
 	e.InlineSuggest = true
+	e.Post = r.manager.Post
+	e.OnChange(func() { r.searchBar.bufferChanged(e) })
 	e.Suggester = func(ctx context.Context, prefix string) string {
 		if len(prefix) < 2 {
 			// avoid abusing suggestions for short prefixes
@@ -1385,6 +1475,7 @@ func NewEditor(r *App) *Editor {
 		}
 		return ""
 	}
+	e.completers = []completer{symbolCompleter(e), wordCompleter(r)}
 	return e
 }
 
@@ -1395,95 +1486,110 @@ func (e *Editor) Layout(r ui.Rect) *ui.Node {
 	}
 }
 
-// HandleKey handles editor-specific keybindings.
-// If the key is not handled here, it will bubble up to the app level.
+// HandleKey runs the action bound to the key,
+// otherwise types the character into the buffer.
 func (e *Editor) HandleKey(ev *tcell.EventKey) bool {
-	switch strings.ToLower(ev.Name()) {
-	case "ctrl+z":
-		e.editor.Undo()
-	case "ctrl+y":
-		e.editor.Redo()
-	case "ctrl+c":
-		s := e.SelectedText()
-		if s == "" {
-			// copy current line by default
-			s = string(e.Line(e.Pos.Row))
-		}
-		e.app.clipboard = s
-		e.app.manager.Screen().SetClipboard([]byte(s))
-	case "ctrl+x":
-		e.editor.SaveEdit()
-		e.MergeNext = false
-		start, end, ok := e.Selection()
-		if !ok {
-			// cut line by default
-			s := string(e.Line(e.Pos.Row)) + "\n"
-			e.app.clipboard = s
-			e.app.manager.Screen().SetClipboard([]byte(s))
-			e.DeleteRange(Pos{Row: e.Pos.Row}, Pos{Row: e.Pos.Row + 1})
-			return true
-		}
-
-		s := e.SelectedText()
-		e.app.clipboard = s
-		e.app.manager.Screen().SetClipboard([]byte(s))
-		e.DeleteRange(start, end)
-		e.ClearSelection()
-	case "ctrl+v":
-		e.editor.SaveEdit()
-		e.MergeNext = false
-		e.InsertText(e.app.clipboard)
-	case "ctrl+d":
-		// if no selection, select the word at current cursor;
-		// if has selection, jump to the next same word, like * in Vim.
-		// To keep things simple, this is not multiple selection (multi-cursor)
-		start, end, ok := e.Selection()
-		if !ok {
-			e.SelectWord()
-		} else if start.Row == end.Row {
-			query := string(e.Line(start.Row)[start.Col:end.Col])
-			e.FindNext(query)
-		}
-	case "ctrl+l":
-		e.ExpandSelectionToLine()
-	case "ctrl+b":
-		e.ExpandSelectionToBrackets()
-	case "ctrl+g":
-		e.gotoDefinition()
-	case "alt+up": // goto first line
-		e.gotoLine(0)
-	case "alt+down": // goto last line
-		e.gotoLine(e.Len() - 1)
-	case "ctrl+a", "alt+left": // goto the first non-space character of line
-		e.ClearSelection()
-		for i, char := range e.Line(e.Pos.Row) {
-			if !unicode.IsSpace(char) {
-				e.Pos.Col = i
-				break
-			}
-		}
-	case "ctrl+e", "alt+right": // goto the end of line
-		e.ClearSelection()
-		e.Pos.Col = len(e.Line(e.Pos.Row))
-	default:
-		if !e.editor.HandleKey(ev) {
-			// Bubble event to parent
-			return e.app.handleGlobalKey(ev)
-		}
+	defer e.settleGoalCol()
+	defer e.settleCompletion()
+	defer e.syncSnippet()
+	if e.app.handleKey(ev) {
+		return true
 	}
+	if !e.editor.HandleKey(ev) {
+		return false
+	}
+	e.updateCompletion(false)
 	return true
 }
 
+func (e *Editor) Draw(s ui.Screen, r ui.Rect) {
+	e.editor.Draw(s, r)
+	e.drawCompletion(s, r)
+}
+
+// copy copies the selection, or the current line if nothing is selected.
+func (e *Editor) copy() {
+	s := e.SelectedText()
+	if s == "" {
+		s = string(e.Line(e.Pos.Row))
+	}
+	e.setClipboard(s)
+}
+
+// cut cuts the selection, or the current line if nothing is selected.
+func (e *Editor) cut() {
+	e.SaveEdit()
+	e.MergeNext = false
+	start, end, ok := e.Selection()
+	if !ok {
+		e.setClipboard(string(e.Line(e.Pos.Row)) + "\n")
+		e.DeleteRange(Pos{Row: e.Pos.Row}, Pos{Row: e.Pos.Row + 1})
+		return
+	}
+
+	e.setClipboard(e.SelectedText())
+	e.DeleteRange(start, end)
+	e.ClearSelection()
+}
+
+func (e *Editor) paste() {
+	e.SaveEdit()
+	e.MergeNext = false
+	e.InsertText(e.app.clipboard)
+}
+
+func (e *Editor) setClipboard(s string) {
+	e.app.clipboard = s
+	e.app.manager.Screen().SetClipboard([]byte(s))
+}
+
+// changeCase converts the selection, or the word at cursor, with fn.
+func (e *Editor) changeCase(fn func(string) string) {
+	if _, _, ok := e.Selection(); !ok {
+		e.SelectWord()
+	}
+	start, _, ok := e.Selection()
+	if !ok {
+		return
+	}
+	e.SaveEdit()
+	e.MergeNext = false
+	e.InsertText(fn(e.SelectedText()))
+	e.SetSelection(start, e.Pos)
+}
+
+// selectWordOrNext selects the word at cursor if nothing is selected,
+// otherwise jumps to the next occurrence of the selection, like * in Vim.
+// It follows the find bar's case and whole word options.
+// To keep things simple, this is not multiple selection (multi-cursor).
+func (e *Editor) selectWordOrNext() {
+	start, end, ok := e.Selection()
+	if !ok {
+		e.SelectWord()
+	} else if start.Row == end.Row {
+		query := string(e.Line(start.Row)[start.Col:end.Col])
+		opts := e.app.searchBar.opts
+		opts.regex = false
+		e.FindNextWith(query, opts)
+	}
+}
+
 // gotoLine moves the cursor to the specified 0-based line number
 // and centers the view on that line.
 func (e *Editor) gotoLine(line int) {
+	e.gotoLineCol(line, 0)
+}
+
+// gotoLineCol moves the cursor to the 0-based line and column, within the
+// text, and records the jump.
+func (e *Editor) gotoLineCol(line, col int) {
 	if line < 0 {
 		line = 0
 	}
 	if line >= e.Len() {
 		line = e.Len() - 1
 	}
-	e.SetCursor(line, 0)
+	e.SetCursor(line, max(col, 0))
 	e.CenterRow(line)
 	e.app.recordJump()
 }
@@ -1508,6 +1614,7 @@ func (e *Editor) updateSymbols() {
 }
 
 func (e *Editor) OnMouseDown(lx, ly int) {
+	e.closeCompletion()
 	e.editor.OnMouseDown(lx, ly)
 	e.app.recordJump()
 }
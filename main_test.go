@@ -1,6 +1,8 @@
 package main
 
 import (
+	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/cansyan/co/ui"
@@ -107,7 +109,7 @@ func TestSearchBarUpdateMatches(t *testing.T) {
 	}
 
 	// Test first match position
-	firstMatch := searchBar.matches[0]
+	firstMatch := searchBar.matches[0].start
 	if firstMatch.Row != 0 || firstMatch.Col != 0 {
 		t.Errorf("First match incorrect. Expected: (0, 0), Got: (%d, %d)", firstMatch.Row, firstMatch.Col)
 	}
@@ -194,22 +196,61 @@ func TestParseFileArg(t *testing.T) {
 		input string
 		path  string
 		line  int
+		col   int
 	}{
-		{"file.txt", "file.txt", 0},
-		{"file.txt:10", "file.txt", 10},
-		{"/path/to/file.txt:25", "/path/to/file.txt", 25},
-		{"file.txt:", "file.txt", 0},
-		{"file.txt:invalid", "file.txt", 0},
+		{"file.txt", "file.txt", 0, 0},
+		{"file.txt:10", "file.txt", 10, 0},
+		{"/path/to/file.txt:25", "/path/to/file.txt", 25, 0},
+		{"file.txt:", "file.txt", 0, 0},
+		{"file.txt:invalid", "file.txt", 0, 0},
+		{"file.txt:20:3", "file.txt", 20, 3},
+		{"file.txt:20:", "file.txt", 20, 0},
 	}
 
 	for _, test := range tests {
-		path, line := parseFileArg(test.input)
+		path, line, col := parseFileArg(test.input)
 		if path != test.path {
 			t.Errorf("parseFileArg(%q) path failed. Expected: %q, Got: %q", test.input, test.path, path)
 		}
 		if line != test.line {
 			t.Errorf("parseFileArg(%q) line failed. Expected: %d, Got: %d", test.input, test.line, line)
 		}
+		if col != test.col {
+			t.Errorf("parseFileArg(%q) col failed. Expected: %d, Got: %d", test.input, test.col, col)
+		}
+	}
+}
+
+func TestParseLineSpec(t *testing.T) {
+	// the cursor is on row 20 of 101 lines
+	tests := []struct {
+		spec     string
+		row, col int
+		ok       bool
+	}{
+		{"10", 9, 0, true},
+		{"10:5", 9, 4, true},
+		{"500", 100, 0, true},
+		{"+10", 30, 0, true},
+		{"-5", 15, 0, true},
+		{"-50", 0, 0, true},
+		{"+5:2", 25, 1, true},
+		{"50%", 50, 0, true},
+		{"0%", 0, 0, true},
+		{"100%", 100, 0, true},
+		{"", 0, 0, false},
+		{"0", 0, 0, false},
+		{"x", 0, 0, false},
+		{"10:", 0, 0, false},
+		{"10:0", 0, 0, false},
+		{"150%", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		row, col, ok := parseLineSpec(tt.spec, 20, 101)
+		if ok != tt.ok || ok && (row != tt.row || col != tt.col) {
+			t.Errorf("parseLineSpec(%q) = %d, %d, %v; want %d, %d, %v", tt.spec, row, col, ok, tt.row, tt.col, tt.ok)
+		}
 	}
 }
 
@@ -255,3 +296,42 @@ func TestHighlightMarkdown(t *testing.T) {
 		}
 	}
 }
+
+func TestOpenArgs(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.go":       "package a\n\nfunc a() {}\n",
+		"b.go":       "package b\n",
+		"c.txt":      "",
+		"pkg/d.go":   "package pkg\n",
+		"dir.go/e.x": "",
+	})
+
+	app := newApp(ui.NewManager())
+	got, err := app.openArgs([]string{
+		filepath.Join(root, "pkg"),
+		filepath.Join(root, "*.go"),
+		filepath.Join(root, "a.go") + ":3:6",
+	}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "pkg"); got != want {
+		t.Errorf("root = %q, want %q", got, want)
+	}
+	// the glob leaves out the directory, a.go is not opened twice
+	var paths []string
+	for _, tab := range app.tabs {
+		paths = append(paths, filepath.Base(tab.path))
+	}
+	if want := []string{"a.go", "b.go"}; !slices.Equal(paths, want) {
+		t.Errorf("tabs = %q, want %q", paths, want)
+	}
+	if e := app.getEditor(); e.Pos != (Pos{Row: 2, Col: 5}) {
+		t.Errorf("cursor at %v, want {2 5}", e.Pos)
+	}
+
+	if _, err := app.openArgs([]string{filepath.Join(root, "*.md")}, nil, false); err == nil {
+		t.Error("a glob matching nothing opened without error")
+	}
+}
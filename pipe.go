@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// co - reads the standard input into an untitled buffer, as a pager:
+// some-cmd | co -. Keys still come from the terminal, tcell reads them
+// from /dev/tty rather than the standard input.
+
+// followInterval is how often text read by a follow is shown.
+// Posting every line would redraw the screen for each of them.
+const followInterval = 100 * time.Millisecond
+
+// openReader opens what r gives in an untitled buffer. With follow, the
+// text is appended as it comes until r ends, like tail -f, otherwise all
+// of it is read first.
+func (a *App) openReader(r io.Reader, follow bool) error {
+	if !follow {
+		bs, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		e := a.newTab("untitled")
+		e.SetText(string(bs))
+		e.Dirty = false
+		return nil
+	}
+
+	e := a.newTab("untitled")
+	ctx, cancel := context.WithCancel(context.Background())
+	a.tabs[a.activeTab].stopFollow = cancel
+	followReader(ctx, r, e, a.manager.Post)
+	return nil
+}
+
+// followReader appends what r gives to e as it comes, through post, until
+// r ends or ctx is done. Done, a reader that can be closed is closed, to
+// not keep reading into a buffer that is gone.
+func followReader(ctx context.Context, r io.Reader, e *Editor, post func(func())) {
+	var (
+		mu      sync.Mutex
+		pending strings.Builder
+		done    bool
+	)
+	if c, ok := r.(io.Closer); ok {
+		context.AfterFunc(ctx, func() { c.Close() })
+	}
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			s, err := br.ReadString('\n')
+			mu.Lock()
+			pending.WriteString(s)
+			done = err != nil
+			mu.Unlock()
+			if err != nil {
+				if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+					log.Print(err)
+				}
+				return
+			}
+		}
+	}()
+	flush := func() {
+		// the tab may have closed since the post
+		if ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		s := pending.String()
+		pending.Reset()
+		mu.Unlock()
+		appendOutput(e, s)
+	}
+	go func() {
+		tick := time.NewTicker(followInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+			mu.Lock()
+			n, finished := pending.Len(), done
+			mu.Unlock()
+			// a flush takes all that is pending, what comes after it is
+			// posted on a later tick
+			if n > 0 {
+				post(flush)
+			} else if finished {
+				return
+			}
+		}
+	}()
+}
+
+// appendOutput appends s at the end of e, and scrolls to keep the end in
+// view unless the user scrolled up from it.
+func appendOutput(e *Editor, s string) {
+	following := e.offsetY+e.viewH >= e.Len()
+	dirty := e.Dirty
+	e.Append(s)
+	e.Dirty = dirty
+	if following {
+		e.offsetY = max(e.Len()-e.viewH, 0)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestOpenReader(t *testing.T) {
+	app := newApp(ui.NewManager())
+	if err := app.openReader(strings.NewReader("one\ntwo\n"), false); err != nil {
+		t.Fatal(err)
+	}
+	e := app.getEditor()
+	if got := e.String(); got != "one\ntwo\n" || e.Dirty || app.tabs[0].path != "untitled" {
+		t.Errorf("buffer %s = %q, dirty %v; want the input, clean", app.tabs[0].path, got, e.Dirty)
+	}
+}
+
+func TestFollowReader(t *testing.T) {
+	app := newApp(ui.NewManager())
+	e := app.newTab("untitled")
+	pr, pw := io.Pipe()
+	// posts are run here, as the UI goroutine would
+	posts := make(chan func(), 1)
+	followReader(context.Background(), pr, e, func(fn func()) { posts <- fn })
+	next := func() {
+		t.Helper()
+		select {
+		case fn := <-posts:
+			fn()
+		case <-time.After(time.Second):
+			t.Fatal("nothing posted")
+		}
+	}
+
+	io.WriteString(pw, "one\n")
+	next()
+	if got := e.String(); got != "one\n" {
+		t.Errorf("buffer = %q after the first line, want %q", got, "one\n")
+	}
+	// appended after the first read
+	io.WriteString(pw, "two\n")
+	next()
+	if got := e.String(); got != "one\ntwo\n" || e.Dirty {
+		t.Errorf("buffer = %q, dirty %v; want %q, clean", got, e.Dirty, "one\ntwo\n")
+	}
+	pw.Close()
+}
+
+func TestFollowStopsWithTab(t *testing.T) {
+	app := newApp(ui.NewManager())
+	pr, pw := io.Pipe()
+	if err := app.openReader(pr, true); err != nil {
+		t.Fatal(err)
+	}
+	app.deleteTab(app.activeTab)
+	// the reader is closed with the tab, shortly after
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := io.WriteString(pw, "more\n")
+		if err == io.ErrClosedPipe {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("write after close = %v, want %v", err, io.ErrClosedPipe)
+		}
+	}
+}
+
+func TestAppendOutput(t *testing.T) {
+	app := newApp(ui.NewManager())
+	e := app.newTab("untitled")
+	e.viewH = 3
+	lines := func(n int) string { return strings.Repeat("line\n", n) }
+
+	// the end stays in view as lines come
+	appendOutput(e, lines(5))
+	if e.offsetY != 3 {
+		t.Errorf("offsetY = %d after 5 lines, want 3", e.offsetY)
+	}
+	// not once scrolled up
+	e.offsetY = 1
+	appendOutput(e, lines(5))
+	if e.offsetY != 1 || e.Dirty {
+		t.Errorf("offsetY = %d, dirty %v after scrolling up; want 1, clean", e.offsetY, e.Dirty)
+	}
+	// again when scrolled back to the end
+	e.offsetY = e.Len() - e.viewH
+	appendOutput(e, lines(2))
+	if want := e.Len() - e.viewH; e.offsetY != want {
+		t.Errorf("offsetY = %d back at the end, want %d", e.offsetY, want)
+	}
+}
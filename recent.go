@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cansyan/co/ui"
+)
+
+// Recent files are the files opened lately, most recent first, with where
+// the cursor was when they were last closed, kept across sessions.
+
+const (
+	recentFile = "recent.json"
+	maxRecent  = 50
+)
+
+type recentEntry struct {
+	Path string `json:"path"` // absolute
+	Row  int    `json:"row"`
+	Col  int    `json:"col"`
+}
+
+// touchRecent moves path to the front of the recent files.
+func (a *App) touchRecent(path string) {
+	entry := recentEntry{Path: path}
+	if i := a.recentIndex(path); i >= 0 {
+		entry = a.recent[i]
+		a.recent = slices.Delete(a.recent, i, i+1)
+	}
+	a.recent = slices.Insert(a.recent, 0, entry)
+	if len(a.recent) > maxRecent {
+		a.recent = a.recent[:maxRecent]
+	}
+}
+
+func (a *App) recentIndex(path string) int {
+	return slices.IndexFunc(a.recent, func(r recentEntry) bool { return r.Path == path })
+}
+
+// keepRecentPos records the cursor of the tab, if its file is a recent one.
+func (a *App) keepRecentPos(t *tab) {
+	if i := a.recentIndex(t.path); i >= 0 {
+		a.recent[i].Row, a.recent[i].Col = t.editor.Pos.Row, t.editor.Pos.Col
+	}
+}
+
+// restoreRecentPos moves the cursor of e to where it was in the file at path.
+func (a *App) restoreRecentPos(path string, e *Editor) {
+	i := a.recentIndex(path)
+	if i < 0 {
+		return
+	}
+	row := min(a.recent[i].Row, e.Len()-1)
+	e.SetCursor(row, a.recent[i].Col)
+	e.CenterRow(row)
+}
+
+// clearRecent forgets the recent files.
+func (a *App) clearRecent() {
+	a.recent = nil
+	a.setStatus("Cleared the recent files", 5*time.Second)
+	a.requestFocus()
+}
+
+// loadRecent restores the recent files from the last session.
+func (a *App) loadRecent() {
+	if err := loadState(recentFile, &a.recent); err != nil {
+		log.Print(err)
+	}
+}
+
+// saveRecent keeps the recent files for the next session,
+// with the cursors of the files still open.
+func (a *App) saveRecent() {
+	for _, t := range a.tabs {
+		a.keepRecentPos(t)
+	}
+	if err := saveState(recentFile, a.recent); err != nil {
+		log.Print(err)
+	}
+}
+
+// displayPath returns path relative to root if it is inside it,
+// as the palette shows it.
+func displayPath(root, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// showRecent lists the recent files in the palette, filtered as typed.
+func (a *App) showRecent() {
+	p := NewPalette(a)
+	p.input.History = nil
+	a.palette = p
+	p.input.OnChange = func() {
+		p.list.Clear()
+		p.list.Index = 0
+		a.fillRecentMode(p, p.input.String())
+	}
+	p.input.SetText("")
+	a.manager.Overlay(p, "top")
+}
+
+func (a *App) fillRecentMode(p *Palette, query string) {
+	p.list.OnSelect = func(item ui.ListItem) {
+		if err := a.openFile(item.Value.(string)); err != nil {
+			a.setStatus(err.Error(), 5*time.Second)
+		}
+		a.requestFocus()
+	}
+	root := a.rootDir()
+	show := func(r recentEntry) string { return displayPath(root, r.Path) }
+	for _, r := range fuzzyFilter(query, a.recent, show) {
+		p.list.Append(ui.ListItem{Name: r.text, Value: r.item.Path, Matches: r.positions})
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cansyan/co/ui"
+)
+
+// Replace in Files previews the replacements of the find bar's query in
+// every file as a diff, where changes can be left out, then applies the
+// ones kept: to the buffer of open files, to the disk otherwise.
+
+// fileChange is a replacement in a file, with the lines it changes.
+type fileChange struct {
+	replacement
+	line     int      // 0-based line of the start
+	col      int      // column of the start
+	old, new []string // the lines before and after
+	include  bool
+}
+
+// fileReplace holds the changes of one file. They apply to content,
+// the text of its open buffer if there was one, otherwise of the file.
+type fileReplace struct {
+	path    string // absolute
+	rel     string // relative to the search root
+	content string
+	buffer  bool
+	changes []fileChange
+}
+
+// collectReplacements returns the changes that replacing the matches of m
+// with repl makes to the files under root. buffers holds the text of open
+// files by absolute path, which is used instead of what is on disk.
+func collectReplacements(ctx context.Context, root string, m *matcher, repl string, buffers map[string]string) ([]*fileReplace, error) {
+	var files []*fileReplace
+	total := 0
+	err := walkFiles(ctx, root, func(path, rel string) error {
+		content, buffer := buffers[path]
+		if !buffer {
+			var ok bool
+			if content, ok = readText(path); !ok {
+				return nil
+			}
+		}
+		rs := m.replacements(content, repl)
+		if len(rs) == 0 {
+			return nil
+		}
+
+		f := &fileReplace{path: path, rel: rel, content: content, buffer: buffer}
+		line, off := 0, 0
+		for _, r := range rs {
+			lineStart := strings.LastIndexByte(content[:r.start], '\n') + 1
+			lineEnd := len(content)
+			if i := strings.IndexByte(content[r.end:], '\n'); i >= 0 {
+				lineEnd = r.end + i
+			}
+			// matches come in order, so lines are counted once
+			line += strings.Count(content[off:lineStart], "\n")
+			off = lineStart
+
+			before := content[lineStart:lineEnd]
+			after := content[lineStart:r.start] + r.text + content[r.end:lineEnd]
+			f.changes = append(f.changes, fileChange{
+				replacement: r,
+				line:        line,
+				col:         utf8.RuneCountInString(content[lineStart:r.start]),
+				old:         strings.Split(before, "\n"),
+				new:         strings.Split(after, "\n"),
+				include:     true,
+			})
+		}
+		files = append(files, f)
+
+		total += len(rs)
+		if total >= maxSearchResults {
+			return errTooManyResults
+		}
+		return nil
+	})
+	return files, err
+}
+
+// included returns the replacements of the changes kept.
+func (f *fileReplace) included() []replacement {
+	var rs []replacement
+	for _, c := range f.changes {
+		if c.include {
+			rs = append(rs, c.replacement)
+		}
+	}
+	return rs
+}
+
+// previewRow locates what a row of the preview shows,
+// change is -1 on the row of the file name.
+type previewRow struct {
+	file, change int
+}
+
+// replacePreview is a Replace in Files run, shown in a tab.
+// It is only touched on the UI goroutine.
+type replacePreview struct {
+	query   string
+	repl    string
+	root    string
+	files   []*fileReplace
+	rows    map[int]previewRow // by row of the preview buffer
+	err     error              // why collecting the changes stopped early
+	running bool
+	applied bool
+	cancel  context.CancelFunc
+}
+
+// previewLabel names the tab of the preview.
+const previewLabel = "Replace Preview"
+
+// render writes the preview to e, keeping the cursor and the view.
+func (p *replacePreview) render(e *Editor) {
+	var sb strings.Builder
+	var decor []Decoration
+	row := 0
+	line := func(s string, style ui.Style) {
+		sb.WriteString(s + "\n")
+		if style != (ui.Style{}) {
+			end := Pos{Row: row, Col: utf8.RuneCountInString(s)}
+			decor = append(decor, Decoration{Start: Pos{Row: row}, End: end, Style: style})
+		}
+		row++
+	}
+
+	p.rows = make(map[int]previewRow)
+	line(fmt.Sprintf("Replace %q with %q in %s", p.query, p.repl, p.root), ui.Style{})
+	switch {
+	case p.running:
+		line("Searching…", ui.Style{})
+	case len(p.files) == 0 && p.err == nil:
+		line("No results", ui.Style{})
+	case errors.Is(p.err, context.Canceled):
+		line("Cancelled, showing the changes found so far", ui.Style{})
+	case p.err != nil && !errors.Is(p.err, errTooManyResults):
+		line(p.err.Error(), ui.Style{})
+	default:
+		line("space includes or excludes a change or a file, alt+enter applies", ui.Theme.Syntax.Comment)
+	}
+
+	removed := ui.Style{FG: ui.Theme.Syntax.Operator.FG}
+	added := ui.Style{FG: ui.Theme.Syntax.String.FG}
+	excluded := ui.Style{FG: ui.Theme.Syntax.Comment.FG}
+	for i, f := range p.files {
+		line("", ui.Style{})
+		p.rows[row] = previewRow{file: i, change: -1}
+		n := len(f.included())
+		line(fmt.Sprintf("%s (%d of %d)", f.rel, n, len(f.changes)), ui.Style{FontBold: true})
+
+		for j, c := range f.changes {
+			mark, oldStyle, newStyle := "[x]", removed, added
+			if !c.include {
+				mark, oldStyle, newStyle = "[ ]", excluded, excluded
+			}
+			prefix := fmt.Sprintf("%s %5d ", mark, c.line+1)
+			pad := strings.Repeat(" ", len(prefix))
+			for k, s := range c.old {
+				p.rows[row] = previewRow{file: i, change: j}
+				if k > 0 {
+					prefix = pad
+				}
+				line(prefix+"- "+strings.TrimSuffix(s, "\r"), oldStyle)
+			}
+			for _, s := range c.new {
+				p.rows[row] = previewRow{file: i, change: j}
+				line(pad+"+ "+strings.TrimSuffix(s, "\r"), newStyle)
+			}
+		}
+	}
+	if errors.Is(p.err, errTooManyResults) {
+		line("", ui.Style{})
+		line(fmt.Sprintf("Stopped at %d changes", maxSearchResults), ui.Style{})
+	}
+
+	pos, offsetY := e.Pos, e.offsetY
+	e.SetText(sb.String())
+	e.SetCursor(min(pos.Row, e.Len()-1), pos.Col)
+	e.offsetY = offsetY
+	e.clampScroll()
+	e.SetDecorations("preview", decor)
+}
+
+// toggle includes or excludes the change at row, on the row of a file
+// name it includes all the file's changes, or excludes them if all are.
+func (p *replacePreview) toggle(row int) bool {
+	r, ok := p.rows[row]
+	if !ok || p.running || p.applied {
+		return false
+	}
+	f := p.files[r.file]
+	if r.change >= 0 {
+		f.changes[r.change].include = !f.changes[r.change].include
+		return true
+	}
+	all := len(f.included()) == len(f.changes)
+	for i := range f.changes {
+		f.changes[i].include = !all
+	}
+	return true
+}
+
+// replaceInFiles previews replacing the query of the find bar with its
+// replacement in the files of the workspace.
+func (a *App) replaceInFiles() {
+	sb := a.searchBar
+	query := sb.input.String()
+	if !a.showSearch || !sb.showReplace || query == "" {
+		a.commands.run("find.replace")
+		a.setStatus("Replace in Files uses the query and replacement of the find bar", 5*time.Second)
+		return
+	}
+	m, err := sb.opts.compile(query)
+	if err != nil {
+		a.setStatus(patternError(err), 5*time.Second)
+		return
+	}
+	root := a.rootDir()
+
+	// open files are replaced in their buffer, so that is what is searched
+	buffers := a.openBuffers()
+
+	t := a.listingTab(previewLabel, func(t *tab) bool { return t.preview != nil })
+	if t.preview != nil {
+		t.preview.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &replacePreview{
+		query:   query,
+		repl:    sb.replace.input.String(),
+		root:    root,
+		running: true,
+		cancel:  cancel,
+	}
+	t.preview = p
+	e := t.editor
+	e.SetCursor(0, 0)
+	p.render(e)
+	a.closeSearch()
+
+	go func() {
+		files, err := collectReplacements(ctx, root, m, p.repl, buffers)
+		a.manager.Post(func() {
+			if t.preview != p || !p.running {
+				return
+			}
+			p.running = false
+			p.files = files
+			p.err = err
+			p.render(e)
+		})
+	}()
+}
+
+// activePreview returns the replace preview shown in the active tab, if any.
+func (a *App) activePreview() *replacePreview {
+	if len(a.tabs) == 0 {
+		return nil
+	}
+	return a.tabs[a.activeTab].preview
+}
+
+// toggleReplace includes or excludes the change at the cursor.
+func (a *App) toggleReplace() {
+	p := a.activePreview()
+	if p == nil {
+		return
+	}
+	e := a.getEditor()
+	if p.toggle(e.Pos.Row) {
+		p.render(e)
+	}
+}
+
+// openChange opens the file of the change at the cursor, at the change.
+func (a *App) openChange() {
+	p := a.activePreview()
+	if p == nil {
+		return
+	}
+	r, ok := p.rows[a.getEditor().Pos.Row]
+	if !ok {
+		return
+	}
+	f := p.files[r.file]
+	c := f.changes[max(r.change, 0)]
+	if err := a.openFile(f.path); err != nil {
+		a.setStatus(err.Error(), 5*time.Second)
+		return
+	}
+	e := a.getEditor()
+	e.SetCursor(c.line, c.col)
+	e.CenterRow(c.line)
+	a.recordJump()
+	a.requestFocus()
+}
+
+// cancelReplace stops collecting the changes of the active preview,
+// reports whether it was still running.
+func (a *App) cancelReplace() bool {
+	p := a.activePreview()
+	if p == nil || !p.running {
+		return false
+	}
+	p.cancel()
+	return true
+}
+
+// applyReplace applies the included changes of the active preview and
+// replaces it with a summary of the files touched. A file whose text
+// changed since the preview is left alone.
+func (a *App) applyReplace() {
+	p := a.activePreview()
+	if p == nil || p.running || p.applied {
+		return
+	}
+	p.applied = true
+
+	var lines []string
+	replaced, touched := 0, 0
+	for _, f := range p.files {
+		rs := f.included()
+		if len(rs) == 0 {
+			continue
+		}
+		note, err := a.replaceFile(f.path, f.content, applyReplacements(f.content, rs))
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: %v", f.rel, err))
+			continue
+		}
+		replaced += len(rs)
+		touched++
+		lines = append(lines, fmt.Sprintf("%s: %s%s", f.rel, plural(len(rs), "replacement"), note))
+	}
+
+	summary := fmt.Sprintf("Replaced %s in %s", plural(replaced, "occurrence"), plural(touched, "file"))
+	e := a.getEditor()
+	e.SetText(fmt.Sprintf("Replace %q with %q in %s\n%s\n\n%s\n", p.query, p.repl, p.root, summary, strings.Join(lines, "\n")))
+	e.SetDecorations("preview", nil)
+	p.rows = nil
+	a.setStatus(summary, 5*time.Second)
+}
+
+// openBuffers returns the text of the files open in tabs, by absolute path.
+func (a *App) openBuffers() map[string]string {
+	buffers := make(map[string]string)
+	for _, t := range a.tabs {
+		if filepath.IsAbs(t.path) && !t.listing() {
+			buffers[t.path] = t.editor.String()
+		}
+	}
+	return buffers
+}
+
+// fileText returns the text of the file at path, from its buffer if it is
+// open, false for a binary file or one that can't be read.
+func (a *App) fileText(path string) (string, bool) {
+	for _, t := range a.tabs {
+		if t.path == path && !t.listing() {
+			return t.editor.String(), true
+		}
+	}
+	return readText(path)
+}
+
+var errChangedSince = errors.New("it changed in the meantime")
+
+// replaceFile changes the text of the file at path from content to text,
+// in its buffer if it is open. A buffer without unsaved changes is saved
+// too, an unsaved one is not. The note tells where the text was changed.
+func (a *App) replaceFile(path, content, text string) (note string, err error) {
+	for _, t := range a.tabs {
+		if t.path != path || t.listing() {
+			continue
+		}
+		e := t.editor
+		if e.String() != content {
+			return "", errChangedSince
+		}
+		if e.Dirty {
+			e.ReplaceText(text)
+			return " in the unsaved buffer", nil
+		}
+		// the file may have changed outside since the buffer was read
+		if disk, ok := readText(path); !ok || bufferText(disk) != content {
+			return "", errChangedSince
+		}
+		e.ReplaceText(text)
+		if err := a.writeFile(path, e); err != nil {
+			return "", err
+		}
+		return " in the buffer, saved", nil
+	}
+
+	disk, ok := readText(path)
+	if !ok || disk != content {
+		return "", errChangedSince
+	}
+	if err := writeFileKeepMode(path, text); err != nil {
+		return "", err
+	}
+	a.savedFile(path, []byte(text))
+	return "", nil
+}
+
+// bufferText returns s as String of a buffer holding it gives it back,
+// which ends the last line.
+func bufferText(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
+
+// writeFileKeepMode writes text to an existing file, keeping its permissions.
+func writeFileKeepMode(path, text string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(text), info.Mode().Perm())
+}
+
+// plural formats a count of things, like "1 file" or "2 files".
+func plural(n int, thing string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, thing)
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
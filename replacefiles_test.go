@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestCollectReplacements(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.txt": "one foo\ntwo\nfoo foo\n",
+		"b.txt": "foo on disk\n",
+		"c.txt": "nothing\n",
+	})
+	m, err := findOptions{}.compile("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffers := map[string]string{filepath.Join(root, "b.txt"): "foo in a buffer\n"}
+
+	files, err := collectReplacements(context.Background(), root, m, "bar", buffers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	a := files[0]
+	var got [][]string
+	for _, c := range a.changes {
+		got = append(got, []string{c.old[0], c.new[0]})
+	}
+	want := [][]string{{"one foo", "one bar"}, {"foo foo", "bar foo"}, {"foo foo", "foo bar"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes of a.txt = %q, want %q", got, want)
+	}
+	if lines := []int{a.changes[0].line, a.changes[1].line, a.changes[2].line}; !reflect.DeepEqual(lines, []int{0, 2, 2}) {
+		t.Errorf("lines of a.txt = %v", lines)
+	}
+
+	a.changes[1].include = false
+	if got := applyReplacements(a.content, a.included()); got != "one bar\ntwo\nfoo bar\n" {
+		t.Errorf("applying the included changes = %q", got)
+	}
+
+	if b := files[1]; !b.buffer || b.content != "foo in a buffer\n" {
+		t.Errorf("b.txt = %+v, want the text of its buffer", b)
+	}
+}
+
+func TestApplyReplace(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"disk.txt":    "foo\n",
+		"dirty.txt":   "foo\n",
+		"changed.txt": "foo\n",
+		"clean.txt":   "foo",
+		"outside.txt": "foo\n",
+	})
+
+	app := newApp(ui.NewManager())
+	dirty := app.newTab(filepath.Join(root, "dirty.txt"))
+	dirty.SetText("foo\n")
+	dirty.Dirty = true
+	// open without unsaved changes, one of them changed outside later
+	for _, name := range []string{"clean.txt", "outside.txt"} {
+		if err := app.openFile(filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, _ := findOptions{}.compile("foo")
+	buffers := app.openBuffers()
+	files, err := collectReplacements(context.Background(), root, m, "bar", buffers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"changed.txt", "outside.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("foo, later\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app.newTab(previewLabel)
+	app.tabs[app.activeTab].preview = &replacePreview{files: files}
+	app.applyReplace()
+
+	read := func(name string) string {
+		bs, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(bs)
+	}
+	if got := read("disk.txt"); got != "bar\n" {
+		t.Errorf("disk.txt = %q, want it replaced", got)
+	}
+	if got := read("changed.txt"); got != "foo, later\n" {
+		t.Errorf("changed.txt = %q, want it left alone", got)
+	}
+	if got := read("clean.txt"); got != "bar\n" {
+		t.Errorf("clean.txt = %q, want it replaced and saved", got)
+	}
+	if got := read("outside.txt"); got != "foo, later\n" {
+		t.Errorf("outside.txt = %q, want the change outside kept", got)
+	}
+	if got := read("dirty.txt"); got != "foo\n" {
+		t.Errorf("dirty.txt on disk = %q, want it left alone", got)
+	}
+	if got := dirty.String(); got != "bar\n" {
+		t.Errorf("dirty buffer = %q, want it replaced", got)
+	}
+	dirty.Undo()
+	if got := dirty.String(); got != "foo\n" {
+		t.Errorf("dirty buffer after undo = %q", got)
+	}
+}
+
+func TestReplaceInFilesPreview(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "foo\n", "b.txt": "foo foo\n"})
+
+	app := newApp(ui.NewManager())
+	app.files = &fileIndex{root: root}
+	sb := app.searchBar
+	app.showSearch, sb.showReplace = true, true
+	sb.input.SetText("foo")
+	sb.replace.input.SetText("bar")
+	app.replaceInFiles()
+	p := app.activePreview()
+	// the result posted by the search runs here, as on the UI goroutine
+	deadline := time.Now().Add(5 * time.Second)
+	for p.running {
+		if time.Now().After(deadline) {
+			t.Fatal("preview still searching")
+		}
+		if !app.manager.RunPosted() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if len(p.files) != 2 || p.err != nil {
+		t.Errorf("preview of %d files, error %v; want 2 files", len(p.files), p.err)
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// A session is what is open in a directory: the tabs, where they are
+// scrolled, and the jump history. It is saved on exit and restored when co
+// starts there without arguments. The text of unsaved buffers goes to
+// files of a backup area, so quitting loses nothing.
+
+type session struct {
+	Dir        string        `json:"dir"`
+	Tabs       []sessionTab  `json:"tabs"`
+	Active     int           `json:"active"`
+	History    []recentEntry `json:"history"`
+	HistoryPos int           `json:"historyPos"`
+}
+
+type sessionTab struct {
+	Path    string `json:"path"`             // absolute, or the label of an untitled buffer
+	Backup  string `json:"backup,omitempty"` // the file holding the unsaved text
+	Row     int    `json:"row"`
+	Col     int    `json:"col"`
+	OffsetY int    `json:"offsetY"`
+}
+
+// sessionName returns the name of the state file, and of the backup
+// directory, of the session of dir.
+func sessionName(dir string) string {
+	return fmt.Sprintf("session-%x", sha256.Sum256([]byte(dir)))[:len("session-")+16]
+}
+
+// backupDir returns the directory holding the unsaved text of the session of dir.
+func backupDir(dir string) (string, error) {
+	state, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(state, "backup", sessionName(dir)), nil
+}
+
+// saveSession saves the session of dir. The backups of the last session
+// are replaced, only once the new ones are all written, so a failed
+// write doesn't lose the last.
+func (a *App) saveSession(dir string) error {
+	backups, err := backupDir(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(backups), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(backups), filepath.Base(backups)+".new")
+	if err != nil {
+		return err
+	}
+	// gone once moved in place, left only by a failure
+	defer os.RemoveAll(tmp)
+
+	s := session{Dir: dir, HistoryPos: -1}
+	for i, t := range a.tabs {
+		// the listings are done again rather than kept
+		if t.listing() {
+			continue
+		}
+		if i == a.activeTab {
+			s.Active = len(s.Tabs)
+		}
+		e := t.editor
+		st := sessionTab{Path: t.path, Row: e.Pos.Row, Col: e.Pos.Col, OffsetY: e.offsetY}
+		if e.Dirty {
+			name := fmt.Sprintf("%d.txt", len(s.Tabs))
+			if err := os.WriteFile(filepath.Join(tmp, name), []byte(e.String()), 0600); err != nil {
+				return err
+			}
+			st.Backup = filepath.Join(backups, name)
+		}
+		s.Tabs = append(s.Tabs, st)
+	}
+
+	// untitled buffers are not places to come back to
+	for i, h := range a.history {
+		if !filepath.IsAbs(h.path) {
+			continue
+		}
+		if i <= a.historyPos {
+			s.HistoryPos = len(s.History)
+		}
+		s.History = append(s.History, recentEntry{Path: h.path, Row: h.pos.Row, Col: h.pos.Col})
+	}
+	if err := replaceDir(tmp, backups); err != nil {
+		return err
+	}
+	return saveState(sessionName(dir)+".json", s)
+}
+
+// replaceDir moves the directory dir to path, in place of the one there.
+// The one there is put back if dir can't be moved.
+func replaceDir(dir, path string) error {
+	old := path + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := os.Rename(path, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(dir, path); err != nil {
+		os.Rename(old, path)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// restoreSession opens the tabs of the session of dir, reports whether
+// there was one to restore. A file gone since is left out.
+func (a *App) restoreSession(dir string) (bool, error) {
+	var s session
+	if err := loadState(sessionName(dir)+".json", &s); err != nil {
+		return false, err
+	}
+
+	active := -1
+	for i, st := range s.Tabs {
+		var e *Editor
+		if st.Backup != "" {
+			bs, err := os.ReadFile(st.Backup)
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			e = a.newTab(st.Path)
+			e.SetText(string(bs))
+			e.updateSymbols()
+			e.Dirty = true
+		} else {
+			if err := a.openFile(st.Path); err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					log.Print(err)
+				}
+				continue
+			}
+			e = a.getEditor()
+		}
+		row := min(st.Row, e.Len()-1)
+		e.SetCursor(row, st.Col)
+		e.offsetY = min(st.OffsetY, row)
+		if i == s.Active {
+			active = len(a.tabs) - 1
+		}
+	}
+	if len(a.tabs) == 0 {
+		return false, nil
+	}
+	a.activeTab = max(active, 0)
+
+	a.history = a.history[:0]
+	for _, h := range s.History {
+		a.history = append(a.history, historyEntry{path: h.Path, pos: Pos{Row: h.Row, Col: h.Col}})
+	}
+	a.historyPos = min(s.HistoryPos, len(a.history)-1)
+	return true, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestSession(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.go":    "package a\n\nfunc a() {}\n",
+		"b.go":    "package b\n",
+		"gone.go": "package gone\n",
+	})
+	a, b := filepath.Join(root, "a.go"), filepath.Join(root, "b.go")
+
+	app := newApp(ui.NewManager())
+	for _, path := range []string{a, filepath.Join(root, "gone.go"), b} {
+		if err := app.openFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.tabs[0].editor.SetCursor(2, 5)
+	app.tabs[0].editor.offsetY = 1
+	app.tabs[2].editor.InsertText("// edited\n")
+	app.newTab("untitled").InsertText("draft")
+	app.activeTab = 2
+	app.pushHistory("untitled", Pos{})
+	if err := app.saveSession(root); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, map[string]string{"b.go": "changed on disk\n"})
+	if err := os.Remove(filepath.Join(root, "gone.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newApp(ui.NewManager())
+	ok, err := restored.restoreSession(root)
+	if err != nil || !ok {
+		t.Fatalf("restoreSession() = %v, %v", ok, err)
+	}
+	var paths []string
+	for _, tab := range restored.tabs {
+		paths = append(paths, tab.path)
+	}
+	if want := []string{a, b, "untitled"}; !slices.Equal(paths, want) {
+		t.Fatalf("tabs = %q, want %q", paths, want)
+	}
+	if restored.activeTab != 1 {
+		t.Errorf("active tab = %d, want 1, b.go", restored.activeTab)
+	}
+
+	e := restored.tabs[0].editor
+	if e.Pos != (Pos{Row: 2, Col: 5}) || e.offsetY != 1 || e.Dirty {
+		t.Errorf("a.go at %v scrolled to %d, dirty %v; want {2 5}, 1, clean", e.Pos, e.offsetY, e.Dirty)
+	}
+	// unsaved text comes from the backup, not from the disk
+	e = restored.tabs[1].editor
+	if got, want := e.String(), "// edited\npackage b\n"; got != want || !e.Dirty {
+		t.Errorf("b.go = %q, dirty %v; want %q, dirty", got, e.Dirty, want)
+	}
+	e = restored.tabs[2].editor
+	if got := e.String(); got != "draft\n" || !e.Dirty {
+		t.Errorf("untitled = %q, dirty %v; want the draft, dirty", got, e.Dirty)
+	}
+
+	// the untitled buffer is left out of the jump history
+	for _, h := range restored.history {
+		if !filepath.IsAbs(h.path) {
+			t.Errorf("history has %q", h.path)
+		}
+	}
+	if n := len(restored.history); n != 3 || restored.historyPos != 2 {
+		t.Errorf("history of %d entries at %d, want 3 at 2", n, restored.historyPos)
+	}
+
+	// no session in another directory
+	if ok, err := newApp(ui.NewManager()).restoreSession(t.TempDir()); ok || err != nil {
+		t.Errorf("restoreSession() of a new directory = %v, %v; want false", ok, err)
+	}
+}
+
+func TestReplaceDir(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "backup")
+	writeFiles(t, root, map[string]string{"backup/0.txt": "old", "new/0.txt": "new"})
+
+	// a failed move keeps the last backups
+	if err := replaceDir(filepath.Join(root, "missing"), path); err == nil {
+		t.Error("replaceDir() of a missing directory succeeded")
+	}
+	if bs, err := os.ReadFile(filepath.Join(path, "0.txt")); err != nil || string(bs) != "old" {
+		t.Errorf("after a failure, backup = %q, %v; want the old one", bs, err)
+	}
+
+	if err := replaceDir(filepath.Join(root, "new"), path); err != nil {
+		t.Fatal(err)
+	}
+	if bs, err := os.ReadFile(filepath.Join(path, "0.txt")); err != nil || string(bs) != "new" {
+		t.Errorf("backup = %q, %v; want the new one", bs, err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("left in the state dir: %v, %v; want only the backups", entries, err)
+	}
+}
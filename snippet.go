@@ -0,0 +1,535 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// snippet is a template inserted by typing its prefix.
+// The body uses the TextMate syntax, see parseSnippet.
+type snippet struct {
+	Prefix      string
+	Body        string
+	Description string
+}
+
+var builtinSnippets = map[string][]snippet{
+	"go": {
+		{Prefix: "iferr", Description: "if err != nil", Body: "if err != nil {\n\treturn ${1:err}\n}$0"},
+		{Prefix: "fn", Description: "function", Body: "func ${1:name}($2) $3 {\n\t$0\n}"},
+		{Prefix: "meth", Description: "method", Body: "func (${1:r} ${2:*T}) ${3:name}($4) $5 {\n\t$0\n}"},
+		{Prefix: "ctor", Description: "constructor", Body: "// New$1 returns a new $1.\nfunc New${1:T}($2) *$1 {\n\treturn &$1{$0}\n}"},
+		{Prefix: "forr", Description: "for range", Body: "for ${1:_}, ${2:v} := range ${3:s} {\n\t$0\n}"},
+		{Prefix: "handler", Description: "HTTP handler", Body: "func ${1:handle}(w http.ResponseWriter, r *http.Request) {\n\t$0\n}"},
+		{Prefix: "test", Description: "table-driven test", Body: `func Test${1:Name}(t *testing.T) {
+	tests := []struct {
+		name string
+		$2
+	}{
+		{$3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			$0
+		})
+	}
+}`},
+		{Prefix: "main", Description: "main package", Body: "package main\n\nfunc main() {\n\t$0\n}"},
+	},
+	"markdown": {
+		{Prefix: "link", Description: "link", Body: "[${1:text}](${2:url})$0"},
+		{Prefix: "img", Description: "image", Body: "![${1:alt}](${2:url})$0"},
+		{Prefix: "code", Description: "code block", Body: "```${1:go}\n$0\n```"},
+		{Prefix: "table", Description: "table", Body: "| ${1:Column} | ${2:Column} |\n| --- | --- |\n| $3 | $4 |$0"},
+		{Prefix: "today", Description: "current date", Body: "$CURRENT_YEAR-$CURRENT_MONTH-$CURRENT_DATE"},
+	},
+}
+
+// snippetsPath returns the location of the user snippets for a language.
+func snippetsPath(lang string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "co", "snippets", lang+".json"), nil
+}
+
+// stringList is a JSON string or array of strings,
+// snippet files use both for prefixes and bodies.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(bs []byte) error {
+	var s string
+	if err := json.Unmarshal(bs, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(bs, (*[]string)(l))
+}
+
+// loadSnippetFile reads snippets in the VS Code format,
+// a missing file is not an error.
+func loadSnippetFile(path string) ([]snippet, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file map[string]struct {
+		Prefix      stringList `json:"prefix"`
+		Body        stringList `json:"body"`
+		Description string     `json:"description"`
+	}
+	if err := json.Unmarshal(bs, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var snippets []snippet
+	for name, s := range file {
+		desc := s.Description
+		if desc == "" {
+			desc = name
+		}
+		for _, prefix := range s.Prefix {
+			snippets = append(snippets, snippet{
+				Prefix:      prefix,
+				Body:        strings.Join(s.Body, "\n"),
+				Description: desc,
+			})
+		}
+	}
+	slices.SortFunc(snippets, func(x, y snippet) int {
+		return strings.Compare(x.Prefix, y.Prefix)
+	})
+	return snippets, nil
+}
+
+// snippetsFor returns the user snippets of a language,
+// followed by the built-in ones they don't override.
+func snippetsFor(lang string) []snippet {
+	var user []snippet
+	if path, err := snippetsPath(lang); err != nil {
+		log.Print(err)
+	} else if user, err = loadSnippetFile(path); err != nil {
+		log.Print(err)
+	}
+
+	snippets := user
+	for _, s := range builtinSnippets[lang] {
+		if !slices.ContainsFunc(user, func(u snippet) bool { return u.Prefix == s.Prefix }) {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets
+}
+
+// snippetPart is a run of literal text or a tab stop of an expanded snippet.
+type snippetPart struct {
+	text   string
+	stop   int  // tab stop number, -1 for literal text
+	mirror bool // whether the text follows another part with the same stop
+}
+
+// parseSnippet expands a snippet body written in the TextMate syntax:
+// $1 and ${1:placeholder} are tab stops, $0 is the final cursor position,
+// a repeated number mirrors the one with a placeholder, $NAME and
+// ${NAME:default} are variables resolved by vars. Lines after the first
+// get indent.
+// A final $0 is added if the body has none.
+func parseSnippet(body, indent string, vars func(name string) (string, bool)) []snippetPart {
+	p := &snippetParser{src: []rune(body), indent: indent, vars: vars}
+	parts := p.parse(false)
+
+	// the first occurrence with a placeholder is edited, the others mirror it
+	fields := make(map[int]int) // stop -> part index
+	for i, part := range parts {
+		j, ok := fields[part.stop]
+		if part.stop >= 0 && (!ok || parts[j].text == "" && part.text != "") {
+			fields[part.stop] = i
+		}
+	}
+	for i, part := range parts {
+		if j, ok := fields[part.stop]; ok && i != j {
+			parts[i].text = parts[j].text
+			parts[i].mirror = true
+		}
+	}
+	if _, ok := fields[0]; !ok {
+		parts = append(parts, snippetPart{stop: 0})
+	}
+	return parts
+}
+
+type snippetParser struct {
+	src    []rune
+	i      int
+	indent string
+	vars   func(name string) (string, bool)
+}
+
+// parse reads parts up to the end of the body,
+// or up to an unescaped '}' inside a placeholder.
+func (p *snippetParser) parse(nested bool) []snippetPart {
+	var parts []snippetPart
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, snippetPart{text: lit.String(), stop: -1})
+			lit.Reset()
+		}
+	}
+
+	for p.i < len(p.src) {
+		r := p.src[p.i]
+		switch {
+		case r == '\\' && p.i+1 < len(p.src) && strings.ContainsRune(`$}\`, p.src[p.i+1]):
+			lit.WriteRune(p.src[p.i+1])
+			p.i += 2
+		case r == '}' && nested:
+			flush()
+			return parts
+		case r == '\n':
+			lit.WriteRune(r)
+			lit.WriteString(p.indent)
+			p.i++
+		case r == '$':
+			part, ok := p.dollar()
+			if !ok {
+				lit.WriteRune(r)
+				p.i++
+			} else if part.stop < 0 {
+				lit.WriteString(part.text)
+			} else {
+				flush()
+				parts = append(parts, part)
+			}
+		default:
+			lit.WriteRune(r)
+			p.i++
+		}
+	}
+	flush()
+	return parts
+}
+
+// dollar reads the tab stop or variable starting at p.i,
+// reports false and reads nothing if it is a plain '$'.
+func (p *snippetParser) dollar() (snippetPart, bool) {
+	start := p.i
+	p.i++
+	braced := p.i < len(p.src) && p.src[p.i] == '{'
+	if braced {
+		p.i++
+	}
+
+	j := p.i
+	if j < len(p.src) && unicode.IsDigit(p.src[j]) {
+		for j < len(p.src) && unicode.IsDigit(p.src[j]) {
+			j++
+		}
+	} else {
+		for j < len(p.src) && (p.src[j] == '_' || unicode.IsLetter(p.src[j]) || unicode.IsDigit(p.src[j])) {
+			j++
+		}
+	}
+	name := string(p.src[p.i:j])
+	p.i = j
+	if name == "" {
+		p.i = start
+		return snippetPart{}, false
+	}
+
+	var def string
+	if braced {
+		if p.i < len(p.src) && p.src[p.i] == ':' {
+			p.i++
+			for _, part := range p.parse(true) {
+				def += part.text
+			}
+		}
+		if p.i >= len(p.src) || p.src[p.i] != '}' {
+			p.i = start
+			return snippetPart{}, false
+		}
+		p.i++
+	}
+
+	if n, err := strconv.Atoi(name); err == nil {
+		return snippetPart{text: def, stop: n}, true
+	}
+	value, ok := p.vars(name)
+	if !ok || value == "" {
+		value = def
+	}
+	return snippetPart{text: value, stop: -1}, true
+}
+
+// snippetSession tracks the tab stops of an inserted snippet
+// while the user fills them in.
+type snippetSession struct {
+	start   Pos           // where the snippet was inserted
+	parts   []snippetPart // the snippet text, kept in sync with the buffer
+	order   []int         // tab stops in visiting order, ending with 0
+	current int           // index into order
+	size    int           // buffer length in runes at the last sync
+}
+
+// field returns the index of the part the current tab stop is edited in,
+// the other parts with the same stop mirror it.
+func (s *snippetSession) field() int {
+	stop := s.order[s.current]
+	return slices.IndexFunc(s.parts, func(p snippetPart) bool { return p.stop == stop && !p.mirror })
+}
+
+// partPos returns where part i starts in the buffer.
+func (s *snippetSession) partPos(i int) Pos {
+	p := s.start
+	for _, part := range s.parts[:i] {
+		p = p.Advance([]rune(part.text))
+	}
+	return p
+}
+
+// InsertSnippet inserts the parts at the cursor and selects the first tab stop.
+func (e *editor) InsertSnippet(parts []snippetPart) {
+	e.clearSuggest()
+	var sb strings.Builder
+	var stops []int
+	for _, part := range parts {
+		sb.WriteString(part.text)
+		if part.stop > 0 && !slices.Contains(stops, part.stop) {
+			stops = append(stops, part.stop)
+		}
+	}
+	slices.Sort(stops)
+
+	s := &snippetSession{
+		start: e.Pos,
+		parts: parts,
+		order: append(stops, 0),
+	}
+	e.InsertText(sb.String())
+	s.size = e.runeCount()
+	e.snippet = s
+	e.selectSnippetField()
+}
+
+// NextSnippetField moves to the next tab stop, the session ends at $0.
+func (e *editor) NextSnippetField() {
+	if e.snippet == nil {
+		return
+	}
+	e.snippet.current++
+	e.selectSnippetField()
+}
+
+// PrevSnippetField moves back to the previous tab stop.
+func (e *editor) PrevSnippetField() {
+	if e.snippet == nil || e.snippet.current == 0 {
+		return
+	}
+	e.snippet.current--
+	e.selectSnippetField()
+}
+
+// ExitSnippet leaves the cursor where it is and forgets the tab stops.
+func (e *editor) ExitSnippet() {
+	e.snippet = nil
+	e.ClearSelection()
+}
+
+// selectSnippetField selects the placeholder of the current tab stop,
+// so typing replaces it.
+func (e *editor) selectSnippetField() {
+	s := e.snippet
+	i := s.field()
+	start := s.partPos(i)
+	end := start.Advance([]rune(s.parts[i].text))
+	if s.order[s.current] == 0 {
+		e.snippet = nil
+	}
+
+	e.ClearSelection()
+	e.Pos = start
+	if start != end {
+		e.SetSelection(start, end)
+	}
+	e.EnsureVisible(e.Pos.Row)
+}
+
+// syncSnippet follows the edits made in the current field and copies its
+// text to the mirrors. Edits or cursor moves outside the field end the session.
+func (e *editor) syncSnippet() {
+	s := e.snippet
+	if s == nil {
+		return
+	}
+
+	size := e.runeCount()
+	i := s.field()
+	start := s.partPos(i)
+	n := len([]rune(s.parts[i].text)) + size - s.size
+	end := e.advance(start, n)
+	if n < 0 || e.Pos.Before(start) || end.Before(e.Pos) {
+		e.snippet = nil
+		return
+	}
+	text := e.textRange(start, end)
+	if text == s.parts[i].text {
+		s.size = size
+		return
+	}
+
+	// rewrite the mirrors in order, so the parts before each one match the buffer
+	offset := len([]rune(e.textRange(start, e.Pos)))
+	s.parts[i].text = text
+	for j, part := range s.parts {
+		if j == i || part.stop != s.parts[i].stop {
+			continue
+		}
+		from := s.partPos(j)
+		e.DeleteRange(from, from.Advance([]rune(part.text)))
+		e.insertRunes(from, []rune(text))
+		s.parts[j].text = text
+	}
+	e.ClearSelection()
+	e.Pos = e.advance(s.partPos(i), offset)
+	s.size = e.runeCount()
+}
+
+// runeCount returns the length of the buffer in runes, newlines included.
+func (e *editor) runeCount() int {
+	n := len(e.buf) - 1
+	for _, line := range e.buf {
+		n += len(line)
+	}
+	return n
+}
+
+// advance returns the position n runes after p, stopping at the end of the buffer.
+func (e *editor) advance(p Pos, n int) Pos {
+	for n > 0 {
+		rest := len(e.buf[p.Row]) - p.Col
+		if n <= rest {
+			p.Col += n
+			return p
+		}
+		if p.Row == len(e.buf)-1 {
+			p.Col = len(e.buf[p.Row])
+			return p
+		}
+		n -= rest + 1
+		p.Row++
+		p.Col = 0
+	}
+	return p
+}
+
+// expandSnippet replaces the word before the cursor with the snippet
+// it is the prefix of, reports whether there was one.
+func (e *Editor) expandSnippet() bool {
+	start, prefix, ok := e.PrefixAtCursor()
+	if !ok {
+		return false
+	}
+	for _, s := range e.snippets {
+		if s.Prefix == prefix {
+			e.insertSnippet(start, s)
+			return true
+		}
+	}
+	return false
+}
+
+// insertSnippet replaces the text from column start up to the cursor with s.
+func (e *Editor) insertSnippet(start int, s snippet) {
+	line := e.buf[e.Pos.Row]
+	lead := 0
+	for lead < len(line) && (line[lead] == ' ' || line[lead] == '\t') {
+		lead++
+	}
+	parts := parseSnippet(s.Body, string(line[:lead]), e.snippetVar)
+
+	e.SaveEdit()
+	e.MergeNext = false
+	e.ClearSelection()
+	e.DeleteRange(Pos{Row: e.Pos.Row, Col: start}, e.Pos)
+	e.InsertSnippet(parts)
+}
+
+// tab expands a snippet, or moves on like the inner editor's InsertTab.
+func (e *Editor) tab() {
+	if !e.expandSnippet() {
+		e.InsertTab()
+	}
+}
+
+// snippetVar resolves the variables that snippets can use.
+func (e *Editor) snippetVar(name string) (string, bool) {
+	path := "untitled"
+	for _, t := range e.app.tabs {
+		if t.editor == e {
+			path = t.path
+		}
+	}
+	now := time.Now()
+
+	switch name {
+	case "TM_FILENAME":
+		return filepath.Base(path), true
+	case "TM_FILENAME_BASE":
+		base := filepath.Base(path)
+		return strings.TrimSuffix(base, filepath.Ext(base)), true
+	case "TM_FILEPATH":
+		return path, true
+	case "TM_DIRECTORY":
+		return filepath.Dir(path), true
+	case "TM_LINE_NUMBER":
+		return strconv.Itoa(e.Pos.Row + 1), true
+	case "TM_LINE_INDEX":
+		return strconv.Itoa(e.Pos.Row), true
+	case "TM_SELECTED_TEXT":
+		return e.SelectedText(), true
+	case "CLIPBOARD":
+		return e.app.clipboard, true
+	case "CURRENT_YEAR":
+		return now.Format("2006"), true
+	case "CURRENT_MONTH":
+		return now.Format("01"), true
+	case "CURRENT_DATE":
+		return now.Format("02"), true
+	case "CURRENT_HOUR":
+		return now.Format("15"), true
+	case "CURRENT_MINUTE":
+		return now.Format("04"), true
+	case "CURRENT_SECOND":
+		return now.Format("05"), true
+	}
+	return "", false
+}
+
+// snippetCompleter offers the snippets whose prefix starts with the word typed.
+func snippetCompleter(e *Editor) completer {
+	return completerFunc(func(prefix string) []completion {
+		var items []completion
+		for i, s := range e.snippets {
+			if len(s.Prefix) >= len(prefix) && strings.EqualFold(s.Prefix[:len(prefix)], prefix) {
+				items = append(items, completion{Text: s.Prefix, Kind: "snippet", snippet: &e.snippets[i]})
+			}
+		}
+		return items
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSnippet(t *testing.T) {
+	vars := func(name string) (string, bool) {
+		if name == "TM_FILENAME" {
+			return "main.go", true
+		}
+		return "", false
+	}
+	lit := func(s string) snippetPart { return snippetPart{text: s, stop: -1} }
+	stop := func(n int, s string) snippetPart { return snippetPart{text: s, stop: n} }
+	mirror := func(n int, s string) snippetPart { return snippetPart{text: s, stop: n, mirror: true} }
+
+	tests := []struct {
+		body string
+		want []snippetPart
+	}{
+		{"plain", []snippetPart{lit("plain"), stop(0, "")}},
+		{"a $1 b$0", []snippetPart{lit("a "), stop(1, ""), lit(" b"), stop(0, "")}},
+		{"${1:name} ${2}", []snippetPart{stop(1, "name"), lit(" "), stop(2, ""), stop(0, "")}},
+		{"$1 = ${1:x}", []snippetPart{mirror(1, "x"), lit(" = "), stop(1, "x"), stop(0, "")}},
+		{"// $TM_FILENAME", []snippetPart{lit("// main.go"), stop(0, "")}},
+		{"${NOPE:def}$NOPE.", []snippetPart{lit("def."), stop(0, "")}},
+		{"${1:$TM_FILENAME}", []snippetPart{stop(1, "main.go"), stop(0, "")}},
+		{`\$1 \} \\ $ ${x`, []snippetPart{lit(`$1 } \ $ ${x`), stop(0, "")}},
+		{"{\n\t$0\n}", []snippetPart{lit("{\n  \t"), stop(0, ""), lit("\n  }")}},
+		{"$12a", []snippetPart{stop(12, ""), lit("a"), stop(0, "")}},
+	}
+
+	for _, tt := range tests {
+		got := parseSnippet(tt.body, "  ", vars)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSnippet(%q) = %+v, want %+v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetSession(t *testing.T) {
+	e := newEditor()
+	e.SetText("x")
+	e.SetCursor(0, 1)
+	e.InsertSnippet(parseSnippet("($1 ${2:v}) $2$0", "", nil))
+
+	// typing into an empty field
+	if e.snippet == nil {
+		t.Fatal("snippet session not started")
+	}
+	e.InsertRune('a')
+	e.syncSnippet()
+	e.InsertRune('b')
+	e.syncSnippet()
+	if got := e.String(); got != "x(ab v) v\n" {
+		t.Fatalf("after typing $1 text = %q", got)
+	}
+
+	// the placeholder is selected, typing replaces it and updates the mirror
+	e.NextSnippetField()
+	if got := e.SelectedText(); got != "v" {
+		t.Fatalf("selected %q, want the placeholder", got)
+	}
+	e.InsertRune('w')
+	e.syncSnippet()
+	e.InsertText("\nz")
+	e.syncSnippet()
+	if got := e.String(); got != "x(ab w\nz) w\nz\n" {
+		t.Fatalf("after typing $2 text = %q", got)
+	}
+
+	e.PrevSnippetField()
+	if got := e.SelectedText(); got != "ab" {
+		t.Fatalf("back to $1 selected %q", got)
+	}
+
+	e.NextSnippetField()
+	e.NextSnippetField()
+	if e.snippet != nil {
+		t.Error("snippet session still active at $0")
+	}
+	if want := (Pos{Row: 2, Col: 1}); e.Pos != want {
+		t.Errorf("cursor at $0 = %v, want %v", e.Pos, want)
+	}
+}
+
+func TestSnippetSessionEnds(t *testing.T) {
+	e := newEditor()
+	e.InsertSnippet(parseSnippet("f(${1:a}, $2)", "", nil))
+	e.MoveLineEnd()
+	e.syncSnippet()
+	if e.snippet != nil {
+		t.Error("snippet session still active after leaving the field")
+	}
+
+	e.SetText("")
+	e.SaveEdit()
+	e.InsertSnippet(parseSnippet("f(${1:a}, $2)", "", nil))
+	e.Undo()
+	if e.snippet != nil {
+		t.Error("snippet session still active after undo")
+	}
+}
+
+func TestLoadSnippetFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go.json")
+	data := `{
+		"Error check": {"prefix": "iferr", "body": ["if err != nil {", "\treturn $1", "}"]},
+		"Print": {"prefix": ["pf", "printf"], "body": "fmt.Printf($1)", "description": "printf"}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadSnippetFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []snippet{
+		{Prefix: "iferr", Body: "if err != nil {\n\treturn $1\n}", Description: "Error check"},
+		{Prefix: "pf", Body: "fmt.Printf($1)", Description: "printf"},
+		{Prefix: "printf", Body: "fmt.Printf($1)", Description: "printf"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadSnippetFile() = %+v, want %+v", got, want)
+	}
+
+	if got, err := loadSnippetFile(filepath.Join(t.TempDir(), "none.json")); got != nil || err != nil {
+		t.Errorf("missing file = %v, %v, want nil, nil", got, err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cansyan/co/ui"
+)
+
+// stateDir returns where state kept between sessions goes, like the
+// history of inputs: $XDG_STATE_HOME/co, or ~/.local/state/co.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "co"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "co"), nil
+}
+
+// loadState reads the state file name into v, a missing file is not an error.
+func loadState(name string, v any) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	bs, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// saveState writes v to the state file name. It goes through a temporary
+// file, so a crash can't leave the file half written.
+func saveState(name string, v any) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(bs); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
+
+const (
+	historyFile = "history.json"
+	maxHistory  = 100 // entries kept per input
+)
+
+// inputHistory returns the history of the input name, such as "find" or "palette".
+func (a *App) inputHistory(name string) *ui.History {
+	h, ok := a.histories[name]
+	if !ok {
+		h = &ui.History{Max: maxHistory}
+		a.histories[name] = h
+	}
+	return h
+}
+
+// loadHistory restores the history of the inputs from the last session.
+func (a *App) loadHistory() {
+	var saved map[string][]string
+	if err := loadState(historyFile, &saved); err != nil {
+		log.Print(err)
+		return
+	}
+	for name, entries := range saved {
+		h := a.inputHistory(name)
+		for _, e := range entries {
+			h.Add(e)
+		}
+	}
+}
+
+// saveHistory keeps the history of the inputs for the next session.
+func (a *App) saveHistory() {
+	saved := make(map[string][]string)
+	for name, h := range a.histories {
+		if len(h.Entries) > 0 {
+			saved[name] = h.Entries
+		}
+	}
+	if err := saveState(historyFile, saved); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cansyan/co/ui"
+)
+
+func TestHistoryState(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	app := newApp(ui.NewManager())
+	find := app.inputHistory("find")
+	for _, q := range []string{"foo", "bar", "foo", ""} {
+		find.Add(q)
+	}
+	app.saveHistory()
+
+	restored := newApp(ui.NewManager())
+	restored.loadHistory()
+	if got, want := restored.inputHistory("find").Entries, []string{"bar", "foo"}; !slices.Equal(got, want) {
+		t.Errorf("restored find history = %q, want %q", got, want)
+	}
+	if got := restored.inputHistory("palette").Entries; len(got) != 0 {
+		t.Errorf("restored palette history = %q, want none", got)
+	}
+}
+
+func TestSearchBarRecall(t *testing.T) {
+	app := newApp(ui.NewManager())
+	app.newTab("untitled").SetText("a b")
+	app.showSearch = true
+	sb := app.searchBar
+	sb.input.History.Entries = []string{"old", "new"}
+
+	steps := []struct {
+		older bool
+		want  string
+	}{
+		{true, "new"},
+		{true, "old"},
+		{true, "old"}, // the oldest stays
+		{false, "new"},
+		{false, ""}, // back to what was typed
+	}
+	for i, step := range steps {
+		sb.recall(step.older)
+		if got := sb.input.String(); got != step.want {
+			t.Errorf("step %d: query = %q, want %q", i, got, step.want)
+		}
+	}
+
+	// with a query typed, up moves between the matches instead
+	sb.input.SetText("b")
+	sb.updateMatches()
+	sb.recall(true)
+	if got := sb.input.String(); got != "b" {
+		t.Errorf("query = %q, want it kept", got)
+	}
+}
+
+func TestRecentFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.go":     "package a\n\nfunc a() {}\n",
+		"b.go":     "package b\n",
+		"sub/c.go": "package c\n",
+	})
+	a, b := filepath.Join(root, "a.go"), filepath.Join(root, "b.go")
+
+	app := newApp(ui.NewManager())
+	app.files = newFileIndex(root)
+	for _, path := range []string{a, b} {
+		if err := app.openFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.tabs[0].editor.SetCursor(2, 5)
+	app.saveRecent()
+
+	restored := newApp(ui.NewManager())
+	restored.files = newFileIndex(root)
+	restored.loadRecent()
+	if err := restored.files.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// with an empty query, the recent files come first, latest first
+	restored.showPalette("")
+	var names []string
+	for _, item := range restored.palette.list.Items {
+		names = append(names, item.Name)
+	}
+	if want := []string{"b.go", "a.go", filepath.Join("sub", "c.go")}; !slices.Equal(names, want) {
+		t.Errorf("palette = %q, want %q", names, want)
+	}
+
+	if err := restored.openFile(a); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.getEditor().Pos, (Pos{Row: 2, Col: 5}); got != want {
+		t.Errorf("reopened at %v, want %v", got, want)
+	}
+	if restored.recent[0].Path != a {
+		t.Errorf("most recent = %s, want %s", restored.recent[0].Path, a)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cansyan/co/ui"
+)
+
+// The symbol index holds the top-level declarations of the Go files of
+// the workspace, for the "#" mode of the palette. It is built in the
+// background, then a file is parsed again when it is saved.
+
+// workspaceSymbol is a top-level declaration of a Go file.
+type workspaceSymbol struct {
+	FullName string // for display, e.g. "(*App).saveFile", "type Foo", "const maxRecent"
+	Path     string // absolute
+	Line     int    // 0-based
+	Col      int    // 0-based, in runes
+}
+
+type symbolIndex struct {
+	root string
+
+	mu    sync.Mutex
+	files map[string][]workspaceSymbol // by absolute path
+	ready bool                         // whether the first build is done
+}
+
+func newSymbolIndex(root string) *symbolIndex {
+	return &symbolIndex{root: root, files: make(map[string][]workspaceSymbol)}
+}
+
+// build parses every Go file under root that git doesn't ignore.
+// It keeps what an update brought in the meantime.
+func (x *symbolIndex) build(ctx context.Context) error {
+	files := make(map[string][]workspaceSymbol)
+	err := walkFiles(ctx, x.root, func(path, rel string) error {
+		if filepath.Ext(path) != ".go" {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		files[path] = parseSymbols(path, src)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for path, syms := range x.files {
+		files[path] = syms
+	}
+	x.files = files
+	x.ready = true
+	return nil
+}
+
+// update parses the file at path again, from its saved text.
+func (x *symbolIndex) update(path string, src []byte) {
+	if x == nil || filepath.Ext(path) != ".go" {
+		return
+	}
+	syms := parseSymbols(path, src)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.files[path] = syms
+}
+
+// list returns the symbols of all files, by path then line, and whether
+// the first build is done.
+func (x *symbolIndex) list() ([]workspaceSymbol, bool) {
+	if x == nil {
+		return nil, false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var all []workspaceSymbol
+	for _, path := range slices.Sorted(maps.Keys(x.files)) {
+		all = append(all, x.files[path]...)
+	}
+	return all, x.ready
+}
+
+// parseSymbols returns the top-level declarations of a Go file.
+// A file with syntax errors gives what could be parsed.
+func parseSymbols(path string, src []byte) []workspaceSymbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+
+	var syms []workspaceSymbol
+	add := func(ident *ast.Ident, fullName string) {
+		if ident == nil || ident.Name == "_" {
+			return
+		}
+		off := fset.Position(ident.Pos()).Offset
+		if off > len(src) {
+			return
+		}
+		lineStart := bytes.LastIndexByte(src[:off], '\n') + 1
+		syms = append(syms, workspaceSymbol{
+			FullName: fullName,
+			Path:     path,
+			Line:     fset.Position(ident.Pos()).Line - 1,
+			Col:      utf8.RuneCount(src[lineStart:off]),
+		})
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = fmt.Sprintf("(%s).%s", receiverType(d.Recv.List[0].Type), name)
+			}
+			add(d.Name, name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name, "type "+s.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						add(n, d.Tok.String()+" "+n.Name)
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+// receiverType formats the type of a receiver like "*App",
+// leaving out type parameters.
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + receiverType(t.X)
+	case *ast.IndexExpr:
+		return receiverType(t.X)
+	case *ast.IndexListExpr:
+		return receiverType(t.X)
+	case *ast.ParenExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
+
+// indexSymbols starts indexing the symbols of the Go files under root.
+func (a *App) indexSymbols(root string) {
+	x := newSymbolIndex(root)
+	a.symbols = x
+	go func() {
+		if err := x.build(context.Background()); err != nil {
+			log.Print(err)
+		}
+		a.manager.Post(func() { a.refreshPalette("#") })
+	}()
+}
+
+func (a *App) fillWorkspaceSymbolMode(p *Palette, query string) {
+	p.list.OnSelect = func(item ui.ListItem) {
+		sym, ok := item.Value.(workspaceSymbol)
+		if !ok {
+			return // still indexing
+		}
+		if err := a.openFile(sym.Path); err != nil {
+			a.setStatus(err.Error(), 5*time.Second)
+			return
+		}
+		if e := a.getEditor(); e != nil {
+			e.SetCursor(sym.Line, sym.Col)
+			e.CenterRow(sym.Line)
+			a.recordJump()
+		}
+		a.requestFocus()
+	}
+
+	syms, ready := a.symbols.list()
+	if !ready && len(syms) == 0 {
+		p.list.Append(ui.ListItem{Name: "Indexing symbols…"})
+		return
+	}
+	root := a.rootDir()
+	// dots separate words too, so "app.save" finds (*App).saveFile
+	query = strings.ReplaceAll(query, ".", " ")
+	results := fuzzyFilter(query, syms, func(s workspaceSymbol) string { return s.FullName })
+	for _, r := range results[:min(len(results), maxPaletteItems)] {
+		where := fmt.Sprintf("%s:%d", displayPath(root, r.item.Path), r.item.Line+1)
+		p.list.Append(ui.ListItem{Name: r.text, Detail: where, Value: r.item, Matches: r.positions})
+	}
+}
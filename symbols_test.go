@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSymbols(t *testing.T) {
+	src := `package p
+
+const (
+	a = 1
+	_ = 2
+)
+
+var x, y int
+
+type T[K any] struct{}
+
+func (t *T[K]) m() {}
+
+func /* é */ f() {
+`
+	var got []workspaceSymbol
+	for _, s := range parseSymbols("p.go", []byte(src)) {
+		s.Path = ""
+		got = append(got, s)
+	}
+	// the file is cut, still the declarations before count
+	want := []workspaceSymbol{
+		{FullName: "const a", Line: 3, Col: 1},
+		{FullName: "var x", Line: 7, Col: 4},
+		{FullName: "var y", Line: 7, Col: 7},
+		{FullName: "type T", Line: 9, Col: 5},
+		{FullName: "(*T).m", Line: 11, Col: 15},
+		{FullName: "f", Line: 13, Col: 13},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSymbols() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestSymbolIndex(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore": "gen/\n",
+		"a.go":       "package a\n\nfunc A() {}\n",
+		"sub/b.go":   "package sub\n\ntype B int\n",
+		"gen/c.go":   "package gen\n\nfunc C() {}\n",
+		"notes.txt":  "func D() {}\n",
+	})
+	x := newSymbolIndex(root)
+	names := func() []string {
+		syms, _ := x.list()
+		var s []string
+		for _, sym := range syms {
+			s = append(s, sym.FullName)
+		}
+		return s
+	}
+	if _, ready := x.list(); ready {
+		t.Error("ready before build")
+	}
+	if err := x.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(), []string{"A", "type B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("symbols = %q, want %q", got, want)
+	}
+
+	// saving a file indexes it again
+	x.update(filepath.Join(root, "a.go"), []byte("package a\n\nfunc A2() {}\n"))
+	x.update(filepath.Join(root, "notes.txt"), []byte("func D() {}\n"))
+	if got, want := names(), []string{"A2", "type B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("symbols after update = %q, want %q", got, want)
+	}
+}
@@ -111,6 +111,31 @@ type Input struct {
 	OnChange    func()
 	OnCommit    func(string) // called when Enter is pressed, with current text
 	Style       Style
+
+	// History, if set, is recalled with Up and Down when the input is
+	// empty or the cursor is at the start.
+	History  *History
+	recalled int    // how many entries back the text is, 0 if none is recalled
+	draft    string // the text from before recalling
+}
+
+// History holds the past entries of an input, oldest first.
+// What is added, and when, is up to the owner of the input.
+type History struct {
+	Entries []string
+	Max     int // how many entries are kept, 0 for no limit
+}
+
+// Add makes s the newest entry, moving it there if it is already in.
+func (h *History) Add(s string) {
+	if s == "" {
+		return
+	}
+	h.Entries = slices.DeleteFunc(h.Entries, func(e string) bool { return e == s })
+	h.Entries = append(h.Entries, s)
+	if h.Max > 0 && len(h.Entries) > h.Max {
+		h.Entries = slices.Delete(h.Entries, 0, len(h.Entries)-h.Max)
+	}
 }
 
 // String returns the current text content
@@ -122,11 +147,53 @@ func (t *Input) SetText(s string) {
 	t.text = []rune(s)
 	t.cursor = len(t.text)
 	t.anchor = t.cursor
+	t.recalled = 0
 	if t.OnChange != nil {
 		t.OnChange()
 	}
 }
 
+// CanRecall reports whether Up recalls the history rather than moving on:
+// the input is empty, the cursor is at the start, or an entry is recalled.
+func (t *Input) CanRecall() bool {
+	return t.History != nil && (t.recalled > 0 || len(t.text) == 0 || t.cursor == 0)
+}
+
+// RecallPrev replaces the text with the entry before the one recalled,
+// or with the newest one, and reports whether there was one.
+func (t *Input) RecallPrev() bool {
+	if t.History == nil || t.recalled >= len(t.History.Entries) {
+		return false
+	}
+	if t.recalled == 0 {
+		t.draft = string(t.text)
+	}
+	t.recall(t.recalled + 1)
+	return true
+}
+
+// RecallNext replaces the text with the entry after the one recalled,
+// past the newest with the text from before recalling.
+// It reports false if no entry is recalled.
+func (t *Input) RecallNext() bool {
+	if t.recalled == 0 {
+		return false
+	}
+	t.recall(t.recalled - 1)
+	return true
+}
+
+// recall shows the entry n back, or the draft for 0.
+func (t *Input) recall(n int) {
+	text := t.draft
+	if n > 0 {
+		entries := t.History.Entries
+		text = entries[len(entries)-n]
+	}
+	t.SetText(text)
+	t.recalled = n
+}
+
 func (t *Input) Size() (int, int) {
 	return 10, 1
 }
@@ -187,7 +254,12 @@ func (t *Input) HandleKey(ev *tcell.EventKey) bool {
 		if t.cursor < len(t.text) {
 			t.cursor++
 		}
+	case tcell.KeyUp:
+		consumed = t.CanRecall() && t.RecallPrev()
+	case tcell.KeyDown:
+		consumed = t.RecallNext()
 	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		t.recalled = 0
 		start, end, ok := t.selection()
 		if ok {
 			t.text = slices.Delete(t.text, start, end)
@@ -200,6 +272,7 @@ func (t *Input) HandleKey(ev *tcell.EventKey) bool {
 			t.OnChange()
 		}
 	case tcell.KeyRune:
+		t.recalled = 0
 		start, end, ok := t.selection()
 		if ok {
 			t.text = slices.Delete(t.text, start, end)
@@ -290,14 +363,20 @@ type List struct {
 }
 
 type ListItem struct {
-	Name  string
-	Value any
+	Name    string
+	Detail  string // dimmed and right-aligned, e.g. a key binding
+	Value   any
+	Matches []int // indexes of the runes of Name to highlight, e.g. matched by a query
 }
 
 func (l *List) Size() (int, int) {
 	maxW := 10
 	for _, it := range l.Items {
-		if w := runewidth.StringWidth(it.Name); w > maxW {
+		w := runewidth.StringWidth(it.Name)
+		if it.Detail != "" {
+			w += runewidth.StringWidth(it.Detail) + 2
+		}
+		if w > maxW {
 			maxW = w
 		}
 	}
@@ -327,14 +406,54 @@ func (l *List) Draw(s Screen, rect Rect) {
 			st.BG = Theme.Selection
 		}
 
-		label := fmt.Sprintf(" %s ", l.Items[i].Name)
+		item := l.Items[i]
+		detail := ""
+		// keep at least half of the row for the name
+		if item.Detail != "" && runewidth.StringWidth(item.Detail)+1 <= rect.W/2 {
+			detail = item.Detail + " "
+		}
+		nameW := rect.W - runewidth.StringWidth(detail)
+		label := fmt.Sprintf(" %s ", item.Name)
 		w := runewidth.StringWidth(label)
-		if w > rect.W {
-			label = runewidth.Truncate(label, rect.W, "…")
+		if w > nameW {
+			label = runewidth.Truncate(label, nameW, "…")
 		} else {
-			label = runewidth.FillRight(label, rect.W)
+			label = runewidth.FillRight(label, nameW)
 		}
 		DrawString(s, rect.X, rect.Y+row, rect.W, label, st)
+		l.drawMatches(s, rect.X+1, rect.Y+row, nameW-2, item, st)
+		if detail != "" {
+			dst := st
+			dst.FG = Theme.Syntax.Comment.FG
+			DrawString(s, rect.X+nameW, rect.Y+row, rect.W-nameW, detail, dst)
+		}
+	}
+}
+
+// drawMatches highlights the matched runes of the item's name, drawn at x
+// with w columns before it is cut off.
+func (l *List) drawMatches(s Screen, x, y, w int, item ListItem, st Style) {
+	if len(item.Matches) == 0 {
+		return
+	}
+	hl := st
+	hl.FG = Theme.Syntax.Keyword.FG
+	hl.FontBold = true
+
+	name := []rune(item.Name)
+	col, next := 0, 0
+	for _, i := range item.Matches {
+		if i < 0 || i >= len(name) {
+			continue
+		}
+		for ; next < i; next++ {
+			col += runewidth.RuneWidth(name[next])
+		}
+		rw := runewidth.RuneWidth(name[i])
+		if col+rw > w {
+			break
+		}
+		s.SetContent(x+col, y, name[i], nil, hl.Apply())
 	}
 }
 
@@ -398,6 +517,15 @@ func (l *List) Prev() {
 	l.ensureVisible()
 }
 
+// Select selects the item at index i, scrolling it into view.
+func (l *List) Select(i int) {
+	if i < 0 || i >= len(l.Items) {
+		return
+	}
+	l.Index = i
+	l.ensureVisible()
+}
+
 func (l *List) Activate() {
 	if l.Index >= 0 && l.Index < len(l.Items) {
 		if l.OnSelect != nil {
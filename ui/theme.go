@@ -9,6 +9,7 @@ type ColorTheme struct {
 	Border     string
 	Hover      string
 	Selection  string
+	Highlight  string // background of search matches, subtler than Selection
 	Syntax     SyntaxStyle
 }
 
@@ -29,6 +30,7 @@ var Breakers = ColorTheme{
 	Border:     "#d9e0e4", // white2 (selection_border)
 	Hover:      "#dae0e2", // white3
 	Selection:  "#dae0e2", // white3 (line_highlight / selection)
+	Highlight:  "#e9eff1",
 	Syntax: SyntaxStyle{
 		Keyword: Style{
 			FG:         "#c594c5", // pink
@@ -60,6 +62,7 @@ var Mariana = ColorTheme{
 	Border:     "#65737e", // blue4 (selection_border)
 	Hover:      "#4e5a65",
 	Selection:  "#4e5a65", // blue2 (alpha handled by terminal blending)
+	Highlight:  "#3f4a54",
 	Syntax: SyntaxStyle{
 		Keyword: Style{
 			FG:         "#c594c5", // pink
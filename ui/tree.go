@@ -0,0 +1,264 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// TreeNode is an entry of a Tree. A branch can be expanded to show its
+// children, which OnExpand of the tree can load the first time.
+type TreeNode struct {
+	Name      string
+	Value     any
+	Branch    bool
+	Expanded  bool
+	Children  []*TreeNode
+	Style     Style  // of the name
+	Mark      string // drawn at the right edge, e.g. "M" for modified
+	MarkStyle Style
+}
+
+// Tree shows nodes in rows, the children of an expanded node indented below it.
+type Tree struct {
+	Roots    []*TreeNode
+	Index    int               // selected row, among the rows shown
+	OnExpand func(n *TreeNode) // called before n expands, e.g. to load its children
+	OnSelect func(n *TreeNode) // called when a leaf is activated, by enter or a click
+
+	offset     int // first row shown
+	viewHeight int
+	focused    bool
+}
+
+// treeRow is a node shown, at its depth.
+type treeRow struct {
+	node  *TreeNode
+	depth int
+}
+
+// rows returns the nodes shown: the roots, and the children of expanded nodes.
+func (t *Tree) rows() []treeRow {
+	var rows []treeRow
+	var add func(nodes []*TreeNode, depth int)
+	add = func(nodes []*TreeNode, depth int) {
+		for _, n := range nodes {
+			rows = append(rows, treeRow{n, depth})
+			if n.Expanded {
+				add(n.Children, depth+1)
+			}
+		}
+	}
+	add(t.Roots, 0)
+	return rows
+}
+
+// Selected returns the node of the selected row, or nil.
+func (t *Tree) Selected() *TreeNode {
+	rows := t.rows()
+	if t.Index < 0 || t.Index >= len(rows) {
+		return nil
+	}
+	return rows[t.Index].node
+}
+
+// Select selects the row of n, scrolling it into view.
+// It reports false if n is not shown, under a collapsed node.
+func (t *Tree) Select(n *TreeNode) bool {
+	for i, r := range t.rows() {
+		if r.node == n {
+			t.Index = i
+			t.ensureVisible()
+			return true
+		}
+	}
+	return false
+}
+
+// Expand shows the children of n.
+func (t *Tree) Expand(n *TreeNode) {
+	if !n.Branch || n.Expanded {
+		return
+	}
+	if t.OnExpand != nil {
+		t.OnExpand(n)
+	}
+	n.Expanded = true
+}
+
+// Collapse hides the children of n, keeping the selection on n
+// if it was on one of them.
+func (t *Tree) Collapse(n *TreeNode) {
+	if !n.Expanded {
+		return
+	}
+	selected := t.Selected()
+	n.Expanded = false
+	if selected != nil && !t.Select(selected) {
+		t.Select(n)
+	}
+}
+
+// Activate expands or collapses the selected branch, or selects the leaf.
+func (t *Tree) Activate() {
+	n := t.Selected()
+	switch {
+	case n == nil:
+	case n.Branch && n.Expanded:
+		t.Collapse(n)
+	case n.Branch:
+		t.Expand(n)
+	case t.OnSelect != nil:
+		t.OnSelect(n)
+	}
+}
+
+func (t *Tree) Size() (int, int) {
+	maxW := 10
+	for _, r := range t.rows() {
+		w := 2*r.depth + 2 + runewidth.StringWidth(r.node.Name)
+		if r.node.Mark != "" {
+			w += runewidth.StringWidth(r.node.Mark) + 1
+		}
+		maxW = max(maxW, w)
+	}
+	return maxW + 2, len(t.rows())
+}
+
+func (t *Tree) Layout(r Rect) *Node {
+	t.viewHeight = r.H
+	return &Node{Element: t, Rect: r}
+}
+
+func (t *Tree) Draw(s Screen, rect Rect) {
+	t.viewHeight = rect.H
+	t.clampOffset()
+	rows := t.rows()
+	for i := t.offset; i < len(rows) && i-t.offset < rect.H; i++ {
+		y := rect.Y + i - t.offset
+		n := rows[i].node
+		var st Style
+		if i == t.Index && t.focused {
+			st.BG = Theme.Selection
+		} else if i == t.Index {
+			st.FontBold = true
+		}
+		DrawString(s, rect.X, y, rect.W, strings.Repeat(" ", rect.W), st)
+
+		icon := "  "
+		if n.Branch && n.Expanded {
+			icon = "▾ "
+		} else if n.Branch {
+			icon = "▸ "
+		}
+		x := rect.X + 1 + 2*rows[i].depth
+		nameW := rect.X + rect.W - 1 - x
+		if n.Mark != "" {
+			markW := runewidth.StringWidth(n.Mark)
+			nameW -= markW + 1
+			DrawString(s, rect.X+rect.W-1-markW, y, markW, n.Mark, n.MarkStyle.Merge(st))
+		}
+		if nameW <= 0 {
+			continue
+		}
+		label := icon + n.Name
+		if runewidth.StringWidth(label) > nameW {
+			label = runewidth.Truncate(label, nameW, "…")
+		}
+		DrawString(s, x, y, nameW, label, n.Style.Merge(st))
+	}
+}
+
+func (t *Tree) HandleKey(ev *tcell.EventKey) bool {
+	rows := t.rows()
+	if len(rows) == 0 {
+		return false
+	}
+	n := t.Selected()
+	switch ev.Key() {
+	case tcell.KeyUp, tcell.KeyCtrlP:
+		t.move(-1)
+	case tcell.KeyDown, tcell.KeyCtrlN:
+		t.move(1)
+	case tcell.KeyPgUp:
+		t.move(-max(t.viewHeight-1, 1))
+	case tcell.KeyPgDn:
+		t.move(max(t.viewHeight-1, 1))
+	case tcell.KeyHome:
+		t.move(-len(rows))
+	case tcell.KeyEnd:
+		t.move(len(rows))
+	case tcell.KeyLeft:
+		// collapse, or go up to the parent
+		if n != nil && n.Expanded {
+			t.Collapse(n)
+			break
+		}
+		for i := t.Index - 1; i >= 0; i-- {
+			if rows[i].depth < rows[t.Index].depth {
+				t.Index = i
+				t.ensureVisible()
+				break
+			}
+		}
+	case tcell.KeyRight:
+		// expand, or go down to the first child
+		if n != nil && n.Branch && !n.Expanded {
+			t.Expand(n)
+		} else if n != nil && len(n.Children) > 0 && n.Expanded {
+			t.move(1)
+		}
+	case tcell.KeyEnter:
+		t.Activate()
+	default:
+		return false
+	}
+	return true
+}
+
+// move moves the selection by delta rows, stopping at the ends.
+func (t *Tree) move(delta int) {
+	n := len(t.rows())
+	if n == 0 {
+		return
+	}
+	t.Index = min(max(t.Index+delta, 0), n-1)
+	t.ensureVisible()
+}
+
+func (t *Tree) OnMouseDown(x, y int) {
+	i := t.offset + y
+	if i >= len(t.rows()) {
+		return
+	}
+	t.Index = i
+	t.Activate()
+}
+
+func (t *Tree) OnMouseUp(x, y int) {}
+
+func (t *Tree) OnScroll(dy int) {
+	t.offset += dy
+	t.clampOffset()
+}
+
+func (t *Tree) OnFocus() { t.focused = true }
+func (t *Tree) OnBlur()  { t.focused = false }
+
+func (t *Tree) ensureVisible() {
+	if t.viewHeight <= 0 {
+		return
+	}
+	if t.Index < t.offset {
+		t.offset = t.Index
+	} else if t.Index >= t.offset+t.viewHeight {
+		t.offset = t.Index - t.viewHeight + 1
+	}
+	t.clampOffset()
+}
+
+func (t *Tree) clampOffset() {
+	t.offset = min(t.offset, len(t.rows())-t.viewHeight)
+	t.offset = max(t.offset, 0)
+}
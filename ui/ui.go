@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/mattn/go-runewidth"
@@ -244,6 +248,24 @@ type Manager struct {
 
 	bindings map[string]func()
 	done     chan struct{}
+
+	// posted holds the functions of Post until the event loop runs them,
+	// live is the screen once it is initialized, to wake the loop with.
+	// Both are shared with other goroutines, under mu.
+	mu     sync.Mutex
+	posted []func()
+	live   Screen
+
+	// ChordTimeout is how long a chord like "ctrl+k ctrl+c" waits
+	// for its next key, defaults to 2 seconds.
+	ChordTimeout time.Duration
+	pending      string // keys typed so far of an unfinished chord
+	pendingGen   int    // identifies the pending chord, for its timeout
+
+	// ChordEnabled reports whether the chord bound to key applies now,
+	// a chord prefix is only taken when one of its chords does.
+	// All chords apply when it is nil.
+	ChordEnabled func(key string) bool
 }
 
 func NewManager() *Manager {
@@ -292,6 +314,11 @@ func hitTest(n *Node, x, y int) (Element, int, int) {
 	return n.Element, x - n.Rect.X, y - n.Rect.Y
 }
 
+// Focused returns the element that currently has keyboard focus, or nil.
+func (m *Manager) Focused() Element {
+	return m.focused
+}
+
 func (m *Manager) SetFocus(e Element) {
 	if e == m.focused {
 		return
@@ -332,7 +359,10 @@ func (m *Manager) blurCurrent() {
 	if f, ok := m.focused.(Focusable); ok {
 		f.OnBlur()
 	}
-	m.screen.HideCursor()
+	// focus can move before Start, e.g. to open a dialog at startup
+	if m.screen != nil {
+		m.screen.HideCursor()
+	}
 }
 
 func (m *Manager) resolveFocus(e Element) Element {
@@ -356,15 +386,54 @@ func (m *Manager) resolveFocus(e Element) Element {
 	}
 }
 
-// Refresh requests a redraw of the UI
+// Refresh requests a redraw of the UI,
+// it is safe to call from any goroutine.
 func (m *Manager) Refresh() {
-	// sends an empty event, wakes screen.PollEvent()
-	m.screen.PostEvent(tcell.NewEventInterrupt(nil))
+	m.wake()
+}
+
+// Post queues fn to run on the UI goroutine, then redraws.
+// It is how background work hands its result back to the UI,
+// and is safe to call from any goroutine. Nothing posted is lost:
+// functions posted before Start run once it begins, in order.
+func (m *Manager) Post(fn func()) {
+	m.mu.Lock()
+	m.posted = append(m.posted, fn)
+	m.mu.Unlock()
+	m.wake()
+}
+
+// RunPosted runs the functions posted so far, and reports whether there
+// were any. The event loop calls it after every event, a test without a
+// screen can call it to do the same.
+func (m *Manager) RunPosted() bool {
+	m.mu.Lock()
+	fns := m.posted
+	m.posted = nil
+	m.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+	return len(fns) > 0
+}
+
+// wake interrupts PollEvent of the event loop, if it runs. A wake dropped
+// by a full event queue is no loss: the queued events wake the loop, which
+// runs what is posted after each of them.
+func (m *Manager) wake() {
+	m.mu.Lock()
+	screen := m.live
+	m.mu.Unlock()
+	if screen != nil {
+		screen.PostEvent(tcell.NewEventInterrupt(nil))
+	}
 }
 
 // Start starts the main event loop
 func (m *Manager) Start(view Element) error {
 	m.view = view
+	// on Unix the screen reads keys from /dev/tty, so they still come
+	// when the standard input is a pipe
 	screen, err := tcell.NewScreen()
 	if err != nil {
 		return err
@@ -376,6 +445,14 @@ func (m *Manager) Start(view Element) error {
 	}
 	defer screen.Fini()
 	screen.EnableMouse()
+	m.mu.Lock()
+	m.live = screen
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.live = nil
+		m.mu.Unlock()
+	}()
 
 	var cursorColor string
 
@@ -389,6 +466,7 @@ func (m *Manager) Start(view Element) error {
 		screen.Show()
 	}
 
+	m.RunPosted()
 	redraw()
 
 	for {
@@ -404,7 +482,7 @@ func (m *Manager) Start(view Element) error {
 
 		switch ev := ev.(type) {
 		case *tcell.EventInterrupt:
-			// waken by Refresh() or Stop()
+			// waken by Refresh(), Post() or Stop()
 			dirty = true
 		case *tcell.EventResize:
 			dirty = true
@@ -416,6 +494,9 @@ func (m *Manager) Start(view Element) error {
 			dirty = m.handleMouse(ev)
 		}
 
+		if m.RunPosted() {
+			dirty = true
+		}
 		if dirty {
 			redraw()
 		}
@@ -433,24 +514,223 @@ func (m *Manager) Stop() {
 		// Still open, close it
 		close(m.done)
 		// Wake up the event loop if it's blocked in PollEvent
-		if m.screen != nil {
-			m.screen.PostEvent(tcell.NewEventInterrupt(nil))
-		}
+		m.wake()
 	}
 }
 
 // BindKey bind the key to the action globally,
-// key should be form of "ctrl+c".
+// key should be form of "ctrl+c", or a chord of space-separated keys
+// like "ctrl+k ctrl+c" or "ctrl+k u". A nil action removes the binding.
+//
+// The first key of a chord is taken before the focused element sees it,
+// then the manager waits ChordTimeout for the rest.
 func (m *Manager) BindKey(key string, action func()) {
-	if key == "" || action == nil {
+	key, err := ParseKey(key)
+	if err != nil {
+		Logger.Print(err)
+		return
+	}
+	if action == nil {
+		delete(m.bindings, key)
 		return
 	}
-	key = strings.ToLower(key)
 	m.bindings[key] = action
 }
 
+// PendingChord returns the keys typed so far of an unfinished chord,
+// and the keys that can follow them.
+func (m *Manager) PendingChord() (string, []string) {
+	if m.pending == "" {
+		return "", nil
+	}
+	var next []string
+	for key := range m.bindings {
+		rest, ok := strings.CutPrefix(key, m.pending+" ")
+		if !ok || !m.chordEnabled(key) {
+			continue
+		}
+		k, _, _ := strings.Cut(rest, " ")
+		if !slices.Contains(next, k) {
+			next = append(next, k)
+		}
+	}
+	slices.Sort(next)
+	return m.pending, next
+}
+
+// isChordPrefix reports whether keys start a bound chord that applies now.
+func (m *Manager) isChordPrefix(keys string) bool {
+	for key := range m.bindings {
+		if strings.HasPrefix(key, keys+" ") && m.chordEnabled(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) chordEnabled(key string) bool {
+	return m.ChordEnabled == nil || m.ChordEnabled(key)
+}
+
+func (m *Manager) setPending(keys string) {
+	m.pending = keys
+	m.pendingGen++
+	if keys == "" {
+		return
+	}
+
+	timeout := m.ChordTimeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	gen := m.pendingGen
+	time.AfterFunc(timeout, func() {
+		m.Post(func() {
+			if gen == m.pendingGen {
+				m.pending = ""
+			}
+		})
+	})
+}
+
+// KeyName returns the normalized name of a key event, such as "ctrl+s",
+// "alt+up" or "x". Printable keys are named by their character,
+// so "A" and "a" are different keys; the space bar is "space".
+func KeyName(ev *tcell.EventKey) string {
+	if ev.Key() != tcell.KeyRune {
+		return strings.ToLower(ev.Name())
+	}
+
+	var sb strings.Builder
+	// Shift is already reflected in the rune itself.
+	mod := ev.Modifiers()
+	if mod&tcell.ModAlt != 0 {
+		sb.WriteString("alt+")
+	}
+	if mod&tcell.ModMeta != 0 {
+		sb.WriteString("meta+")
+	}
+	if mod&tcell.ModCtrl != 0 {
+		sb.WriteString("ctrl+")
+	}
+	if r := ev.Rune(); r == ' ' {
+		sb.WriteString("space")
+	} else {
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// keyNames holds the lowercase names of the non-printable keys.
+var keyNames = func() map[string]bool {
+	names := make(map[string]bool, len(tcell.KeyNames))
+	for _, name := range tcell.KeyNames {
+		name = strings.ToLower(name)
+		// control keys are spelled with a modifier, e.g. "ctrl+a"
+		if strings.HasPrefix(name, "ctrl-") {
+			continue
+		}
+		names[name] = true
+	}
+	return names
+}()
+
+// ParseKey normalizes a key description like "Ctrl+Shift+Up" into the
+// form returned by KeyName, so user-written keys can be compared with events.
+// A chord of space-separated keys is normalized key by key.
+func ParseKey(s string) (string, error) {
+	keys := strings.Fields(s)
+	if len(keys) == 0 {
+		return "", fmt.Errorf("empty key")
+	}
+	for i, key := range keys {
+		k, err := parseKey(key)
+		if err != nil {
+			return "", err
+		}
+		keys[i] = k
+	}
+	return strings.Join(keys, " "), nil
+}
+
+func parseKey(s string) (string, error) {
+	// The last "+" that is not the final character separates modifiers
+	// from the key, which allows "ctrl++".
+	base := s
+	var mods []string
+	if i := strings.LastIndex(s[:len(s)-1], "+"); i >= 0 {
+		mods = strings.Split(strings.ToLower(s[:i]), "+")
+		base = s[i+1:]
+	}
+
+	var shift, alt, meta, ctrl bool
+	for _, mod := range mods {
+		switch mod {
+		case "shift":
+			shift = true
+		case "alt":
+			alt = true
+		case "meta":
+			meta = true
+		case "ctrl":
+			ctrl = true
+		default:
+			return "", fmt.Errorf("key %q: unknown modifier %q", s, mod)
+		}
+	}
+
+	if utf8.RuneCountInString(base) == 1 {
+		// terminals cannot tell ctrl+S from ctrl+s
+		if ctrl {
+			base = strings.ToLower(base)
+		}
+		// like KeyName, shift is carried by the character
+		shift = false
+	} else {
+		base = strings.ToLower(base)
+		if base != "space" && !keyNames[base] {
+			return "", fmt.Errorf("key %q: unknown key %q", s, base)
+		}
+	}
+
+	var sb strings.Builder
+	if shift {
+		sb.WriteString("shift+")
+	}
+	if alt {
+		sb.WriteString("alt+")
+	}
+	if meta {
+		sb.WriteString("meta+")
+	}
+	if ctrl {
+		sb.WriteString("ctrl+")
+	}
+	sb.WriteString(base)
+	return sb.String(), nil
+}
+
 func (m *Manager) handleKey(ev *tcell.EventKey) {
-	Logger.Printf("key %s", ev.Name())
+	key := KeyName(ev)
+	Logger.Printf("key %s", key)
+
+	// 0. Chords take keys before anyone else,
+	// an unbound key cancels the pending chord.
+	if m.pending != "" {
+		keys := m.pending + " " + key
+		m.setPending("")
+		if action, ok := m.bindings[keys]; ok {
+			action()
+		} else if m.isChordPrefix(keys) {
+			m.setPending(keys)
+		}
+		return
+	}
+	if m.isChordPrefix(key) {
+		m.setPending(key)
+		return
+	}
+
 	// 1. Give the focused element first chance to handle the key event
 	if m.focused != nil {
 		if h, ok := m.focused.(KeyHandler); ok {
@@ -467,7 +747,6 @@ func (m *Manager) handleKey(ev *tcell.EventKey) {
 	}
 
 	// 3. Fallback to global bindings
-	key := strings.ToLower(ev.Name())
 	if action, ok := m.bindings[key]; ok {
 		action()
 		return